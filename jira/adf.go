@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdfNode is one node of Atlassian Document Format, the JSON tree Jira's v3
+// API uses for descriptions and comment bodies.
+// See https://developer.atlassian.com/cloud/jira/platform/apis/document/structure/
+type AdfNode struct {
+	Type    string         `json:"type"`
+	Text    string         `json:"text,omitempty"`
+	Attrs   map[string]any `json:"attrs,omitempty"`
+	Marks   []AdfMark      `json:"marks,omitempty"`
+	Content []AdfNode      `json:"content,omitempty"`
+}
+
+type AdfMark struct {
+	Type  string         `json:"type"`
+	Attrs map[string]any `json:"attrs,omitempty"`
+}
+
+// ParseADF decodes a raw ADF document. Jira sends null for an empty field,
+// which parses to nil rather than an error.
+func ParseADF(raw json.RawMessage) (*AdfNode, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	// Fields that were never migrated to ADF still come back as plain strings.
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return &AdfNode{Type: "doc", Content: []AdfNode{{Type: "paragraph", Content: []AdfNode{{Type: "text", Text: text}}}}}, nil
+	}
+
+	var doc AdfNode
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("decode adf: %w", err)
+	}
+	return &doc, nil
+}
+
+func (n *AdfNode) Markdown() string {
+	if n == nil {
+		return ""
+	}
+	return strings.TrimSpace(adfRenderer{markdown: true}.block(*n))
+}
+
+func (n *AdfNode) PlainText() string {
+	if n == nil {
+		return ""
+	}
+	return strings.TrimSpace(adfRenderer{}.block(*n))
+}
+
+// adfToMarkdown is the shortcut used wherever a raw Jira field is turned into
+// prompt text; unparseable content is treated as empty.
+func adfToMarkdown(raw json.RawMessage) string {
+	doc, err := ParseADF(raw)
+	if err != nil {
+		return ""
+	}
+	return doc.Markdown()
+}
+
+type adfRenderer struct {
+	markdown bool
+}
+
+func (a adfRenderer) blocks(nodes []AdfNode, separator string) string {
+	var parts []string
+	for _, node := range nodes {
+		if text := a.block(node); strings.TrimSpace(text) != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, separator)
+}
+
+func (a adfRenderer) block(n AdfNode) string {
+	switch n.Type {
+	case "doc":
+		return a.blocks(n.Content, "\n\n")
+	case "paragraph":
+		return a.inline(n.Content)
+	case "heading":
+		text := a.inline(n.Content)
+		if !a.markdown {
+			return text
+		}
+		level := min(max(attrInt(n.Attrs, "level", 1), 1), 6)
+		return strings.Repeat("#", level) + " " + text
+	case "bulletList", "taskList", "decisionList":
+		return a.list(n, false)
+	case "orderedList":
+		return a.list(n, true)
+	case "codeBlock":
+		code := a.plainInline(n.Content)
+		if !a.markdown {
+			return code
+		}
+		return "```" + attrString(n.Attrs, "language") + "\n" + code + "\n```"
+	case "blockquote", "panel":
+		inner := a.blocks(n.Content, "\n\n")
+		if !a.markdown {
+			return inner
+		}
+		return prefixLines(inner, "> ")
+	case "rule":
+		if a.markdown {
+			return "---"
+		}
+		return ""
+	case "table":
+		return a.table(n)
+	case "expand", "nestedExpand":
+		inner := a.blocks(n.Content, "\n\n")
+		title := attrString(n.Attrs, "title")
+		if title == "" {
+			return inner
+		}
+		if a.markdown {
+			title = "**" + title + "**"
+		}
+		return title + "\n\n" + inner
+	case "blockCard", "embedCard":
+		return a.card(n)
+	case "mediaSingle", "mediaGroup", "media":
+		return ""
+	default:
+		if isInlineNode(n.Type) {
+			return a.inline([]AdfNode{n})
+		}
+		return a.blocks(n.Content, "\n\n")
+	}
+}
+
+func (a adfRenderer) list(n AdfNode, ordered bool) string {
+	start := attrInt(n.Attrs, "order", 1)
+
+	var items []string
+	for i, item := range n.Content {
+		marker := "- "
+		if ordered {
+			marker = strconv.Itoa(start+i) + ". "
+		}
+
+		var body string
+		switch item.Type {
+		case "taskItem":
+			if a.markdown {
+				if attrString(item.Attrs, "state") == "DONE" {
+					marker += "[x] "
+				} else {
+					marker += "[ ] "
+				}
+			}
+			body = a.inline(item.Content)
+		case "decisionItem":
+			body = a.inline(item.Content)
+		default:
+			body = a.blocks(item.Content, "\n")
+		}
+
+		items = append(items, marker+indentFollowing(body, strings.Repeat(" ", len(marker))))
+	}
+	return strings.Join(items, "\n")
+}
+
+func (a adfRenderer) table(n AdfNode) string {
+	var rows []string
+	for i, row := range n.Content {
+		var cells []string
+		for _, cell := range row.Content {
+			text := strings.ReplaceAll(a.blocks(cell.Content, " "), "\n", " ")
+			if a.markdown {
+				text = strings.ReplaceAll(text, "|", `\|`)
+			}
+			cells = append(cells, text)
+		}
+
+		if !a.markdown {
+			rows = append(rows, strings.Join(cells, " | "))
+			continue
+		}
+		rows = append(rows, "| "+strings.Join(cells, " | ")+" |")
+		if i == 0 {
+			rows = append(rows, "|"+strings.Repeat(" --- |", len(cells)))
+		}
+	}
+	return strings.Join(rows, "\n")
+}
+
+func (a adfRenderer) card(n AdfNode) string {
+	url := attrString(n.Attrs, "url")
+	if url == "" || !a.markdown {
+		return url
+	}
+	return "<" + url + ">"
+}
+
+func isInlineNode(nodeType string) bool {
+	switch nodeType {
+	case "text", "hardBreak", "mention", "emoji", "inlineCard", "date", "status", "placeholder":
+		return true
+	}
+	return false
+}
+
+func (a adfRenderer) inline(nodes []AdfNode) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		switch n.Type {
+		case "text":
+			b.WriteString(a.text(n))
+		case "hardBreak":
+			if a.markdown {
+				b.WriteString("  \n")
+			} else {
+				b.WriteString("\n")
+			}
+		case "mention":
+			b.WriteString("@" + strings.TrimPrefix(attrString(n.Attrs, "text"), "@"))
+		case "emoji":
+			if text := attrString(n.Attrs, "text"); text != "" {
+				b.WriteString(text)
+			} else {
+				b.WriteString(attrString(n.Attrs, "shortName"))
+			}
+		case "inlineCard":
+			b.WriteString(a.card(n))
+		case "date":
+			b.WriteString(formatAdfDate(attrString(n.Attrs, "timestamp")))
+		case "status":
+			b.WriteString("[" + attrString(n.Attrs, "text") + "]")
+		default:
+			b.WriteString(a.inline(n.Content))
+		}
+	}
+	return b.String()
+}
+
+func (a adfRenderer) plainInline(nodes []AdfNode) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		if n.Type == "hardBreak" {
+			b.WriteString("\n")
+			continue
+		}
+		b.WriteString(n.Text)
+		b.WriteString(a.plainInline(n.Content))
+	}
+	return b.String()
+}
+
+func (a adfRenderer) text(n AdfNode) string {
+	text := n.Text
+	href := ""
+	for _, mark := range n.Marks {
+		if mark.Type == "link" {
+			href = attrString(mark.Attrs, "href")
+		}
+	}
+
+	if !a.markdown {
+		if href != "" && href != text {
+			return text + " (" + href + ")"
+		}
+		return text
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return text
+	}
+	for _, mark := range n.Marks {
+		switch mark.Type {
+		case "code":
+			text = "`" + text + "`"
+		case "strong":
+			text = "**" + text + "**"
+		case "em":
+			text = "*" + text + "*"
+		case "strike":
+			text = "~~" + text + "~~"
+		}
+	}
+	if href != "" {
+		text = "[" + text + "](" + href + ")"
+	}
+	return text
+}
+
+func formatAdfDate(timestamp string) string {
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return timestamp
+	}
+	return time.UnixMilli(ms).UTC().Format(issueDateLayout)
+}
+
+func prefixLines(text string, prefix string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = strings.TrimRight(prefix, " ")
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// indentFollowing indents every line but the first, which sits after a list
+// marker.
+func indentFollowing(text string, indent string) string {
+	lines := strings.Split(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = indent + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func attrString(attrs map[string]any, key string) string {
+	switch value := attrs[key].(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return ""
+}
+
+func attrInt(attrs map[string]any, key string, fallback int) int {
+	switch value := attrs[key].(type) {
+	case float64:
+		return int(value)
+	case string:
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseADFEmpty(t *testing.T) {
+	for _, raw := range []string{"", "null"} {
+		doc, err := ParseADF(json.RawMessage(raw))
+		if err != nil || doc != nil {
+			t.Errorf("ParseADF(%q) = %v, %v, want nil, nil", raw, doc, err)
+		}
+		if got := doc.Markdown(); got != "" {
+			t.Errorf("nil Markdown() = %q", got)
+		}
+	}
+
+	if _, err := ParseADF(json.RawMessage(`{"type":`)); err == nil {
+		t.Error("ParseADF accepted malformed JSON")
+	}
+}
+
+func TestADFRendering(t *testing.T) {
+	tests := []struct {
+		name     string
+		adf      string
+		markdown string
+		plain    string
+	}{
+		{
+			name:     "legacy string field",
+			adf:      `"plain *old* text"`,
+			markdown: "plain *old* text",
+			plain:    "plain *old* text",
+		},
+		{
+			name: "heading and paragraphs",
+			adf: `{"type":"doc","content":[
+				{"type":"heading","attrs":{"level":2},"content":[{"type":"text","text":"Title"}]},
+				{"type":"paragraph","content":[{"type":"text","text":"First"}]},
+				{"type":"paragraph","content":[]},
+				{"type":"paragraph","content":[{"type":"text","text":"Second"}]}]}`,
+			markdown: "## Title\n\nFirst\n\nSecond",
+			plain:    "Title\n\nFirst\n\nSecond",
+		},
+		{
+			name: "marks and links",
+			adf: `{"type":"doc","content":[{"type":"paragraph","content":[
+				{"type":"text","text":"bold","marks":[{"type":"strong"}]},
+				{"type":"text","text":" and "},
+				{"type":"text","text":"docs","marks":[{"type":"link","attrs":{"href":"https://example.com"}}]},
+				{"type":"text","text":" "},
+				{"type":"text","text":"x()","marks":[{"type":"code"}]}]}]}`,
+			markdown: "**bold** and [docs](https://example.com) `x()`",
+			plain:    "bold and docs (https://example.com) x()",
+		},
+		{
+			name: "nested lists",
+			adf: `{"type":"doc","content":[{"type":"orderedList","attrs":{"order":3},"content":[
+				{"type":"listItem","content":[
+					{"type":"paragraph","content":[{"type":"text","text":"three"}]},
+					{"type":"bulletList","content":[{"type":"listItem","content":[
+						{"type":"paragraph","content":[{"type":"text","text":"nested"}]}]}]}]},
+				{"type":"listItem","content":[{"type":"paragraph","content":[{"type":"text","text":"four"}]}]}]}]}`,
+			markdown: "3. three\n   - nested\n4. four",
+			plain:    "3. three\n   - nested\n4. four",
+		},
+		{
+			name: "task list",
+			adf: `{"type":"doc","content":[{"type":"taskList","content":[
+				{"type":"taskItem","attrs":{"state":"DONE"},"content":[{"type":"text","text":"done"}]},
+				{"type":"taskItem","attrs":{"state":"TODO"},"content":[{"type":"text","text":"todo"}]}]}]}`,
+			markdown: "- [x] done\n- [ ] todo",
+			plain:    "- done\n- todo",
+		},
+		{
+			name: "code block",
+			adf: `{"type":"doc","content":[{"type":"codeBlock","attrs":{"language":"go"},"content":[
+				{"type":"text","text":"a := 1"},{"type":"hardBreak"},{"type":"text","text":"b := 2"}]}]}`,
+			markdown: "```go\na := 1\nb := 2\n```",
+			plain:    "a := 1\nb := 2",
+		},
+		{
+			name: "quote and rule",
+			adf: `{"type":"doc","content":[
+				{"type":"blockquote","content":[
+					{"type":"paragraph","content":[{"type":"text","text":"one"}]},
+					{"type":"paragraph","content":[{"type":"text","text":"two"}]}]},
+				{"type":"rule"}]}`,
+			markdown: "> one\n>\n> two\n\n---",
+			plain:    "one\n\ntwo",
+		},
+		{
+			name: "table escapes pipes",
+			adf: `{"type":"doc","content":[{"type":"table","content":[
+				{"type":"tableRow","content":[
+					{"type":"tableHeader","content":[{"type":"paragraph","content":[{"type":"text","text":"Key"}]}]},
+					{"type":"tableHeader","content":[{"type":"paragraph","content":[{"type":"text","text":"Value"}]}]}]},
+				{"type":"tableRow","content":[
+					{"type":"tableCell","content":[{"type":"paragraph","content":[{"type":"text","text":"a|b"}]}]},
+					{"type":"tableCell","content":[{"type":"paragraph","content":[{"type":"text","text":"1"}]}]}]}]}]}`,
+			markdown: "| Key | Value |\n| --- | --- |\n| a\\|b | 1 |",
+			plain:    "Key | Value\na|b | 1",
+		},
+		{
+			name: "inline nodes",
+			adf: `{"type":"doc","content":[{"type":"paragraph","content":[
+				{"type":"mention","attrs":{"text":"@Ann"}},
+				{"type":"text","text":" "},
+				{"type":"emoji","attrs":{"shortName":":tada:","text":"🎉"}},
+				{"type":"text","text":" "},
+				{"type":"status","attrs":{"text":"DONE"}},
+				{"type":"text","text":" "},
+				{"type":"date","attrs":{"timestamp":"1735689600000"}},
+				{"type":"text","text":" "},
+				{"type":"inlineCard","attrs":{"url":"https://example.com/card"}}]}]}`,
+			markdown: "@Ann 🎉 [DONE] 2025-01-01 <https://example.com/card>",
+			plain:    "@Ann 🎉 [DONE] 2025-01-01 https://example.com/card",
+		},
+		{
+			name: "media is dropped and unknown blocks keep their text",
+			adf: `{"type":"doc","content":[
+				{"type":"mediaSingle","content":[{"type":"media","attrs":{"id":"1"}}]},
+				{"type":"somethingNew","content":[{"type":"paragraph","content":[{"type":"text","text":"kept"}]}]}]}`,
+			markdown: "kept",
+			plain:    "kept",
+		},
+		{
+			name: "expand keeps its title",
+			adf: `{"type":"doc","content":[{"type":"expand","attrs":{"title":"More"},"content":[
+				{"type":"paragraph","content":[{"type":"text","text":"hidden"}]}]}]}`,
+			markdown: "**More**\n\nhidden",
+			plain:    "More\n\nhidden",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseADF(json.RawMessage(tt.adf))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := doc.Markdown(); got != tt.markdown {
+				t.Errorf("Markdown() =\n%q\nwant\n%q", got, tt.markdown)
+			}
+			if got := doc.PlainText(); got != tt.plain {
+				t.Errorf("PlainText() =\n%q\nwant\n%q", got, tt.plain)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"JiraConnect/shared"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// batchKeyLimit caps a batch at more than a busy month's worth of issues.
+const batchKeyLimit = 100
+
+type BatchPayload struct {
+	Keys  []string `json:"keys"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// BatchResult is one issue's outcome. Exactly one of Entry and Error is set.
+type BatchResult struct {
+	Key   string `json:"key"`
+	Entry *Entry `json:"entry,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Results   []BatchResult `json:"results"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+}
+
+// batchKeys checks and de-duplicates the requested keys, keeping their order.
+func batchKeys(keys []string) ([]string, error) {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, key := range keys {
+		key = strings.ToUpper(strings.TrimSpace(key))
+		if !issueKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid issue key %q", key)
+		}
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+	if len(unique) == 0 {
+		return nil, errors.New("keys are required")
+	}
+	if len(unique) > batchKeyLimit {
+		return nil, fmt.Errorf("at most %d issues can be generated at once", batchKeyLimit)
+	}
+	return unique, nil
+}
+
+// transformIssue loads one issue from Jira, generates its entry and stores
+// it, the same way /transform does for a single issue. onText, when set, is
+// given the model's text as it streams.
+func transformIssue(ctx context.Context, log *log.Logger, client *JiraClient, site shared.Site, generator Generator, store Repository, user shared.User, key string, filter CommentFilter, onText func(text string)) (Entry, error) {
+	content, err := client.IssueContent(ctx, log, key, filter)
+	if err != nil {
+		return Entry{}, err
+	}
+	content.Url = site.Url + "/browse/" + key
+
+	result, err := generateEntryStream(ctx, generator, content, onText)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	entry := Entry{
+		AccountId:     user.AccountId,
+		Key:           content.Key,
+		Url:           content.Url,
+		Heading:       result.Heading,
+		Description:   result.Description,
+		Links:         result.Links,
+		PromptVersion: result.PromptVersion,
+	}
+	if err := createEntry(ctx, store, &entry, RevisionSourceModel, user); err != nil {
+		return entry, fmt.Errorf("store entry: %w", err)
+	}
+	return entry, nil
+}
+
+// transformErrorMessage is what the page is told about a failed issue; the
+// details stay in the log.
+func transformErrorMessage(err error) string {
+	var jiraErr *JiraError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "generation timed out"
+	case errors.As(err, &jiraErr) && jiraErr.StatusCode == http.StatusNotFound:
+		return "issue not found"
+	case errors.As(err, &jiraErr) && jiraErr.StatusCode == http.StatusUnauthorized:
+		return "not authorised"
+	case errors.As(err, &jiraErr):
+		return "error retrieving issue"
+	default:
+		return "generation failed"
+	}
+}
+
+// forEachConcurrently calls fn for every index in [0, n) from at most workers
+// goroutines at once, and returns when all calls have.
+func forEachConcurrently(n int, workers int, fn func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := range n {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// batchRun is a checked batch request along with the Jira client to run it
+// against.
+type batchRun struct {
+	keys   []string
+	client *JiraClient
+	site   shared.Site
+	user   shared.User
+	filter CommentFilter
+}
+
+// decodeBatch reads a BatchPayload and resolves the caller's site, writing
+// the error response itself when it can't.
+func decodeBatch(w http.ResponseWriter, r *http.Request, log *log.Logger, jiraConfig shared.JiraConfig, httpClient *http.Client, sessions *shared.Sessions) (batchRun, bool) {
+	var payload BatchPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid JSON payload: "+err.Error(), http.StatusBadRequest)
+		return batchRun{}, false
+	}
+
+	keys, err := batchKeys(payload.Keys)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return batchRun{}, false
+	}
+
+	client, site, err := siteClient(r, jiraConfig, httpClient, sessions)
+	if err != nil {
+		http.Error(w, "Unable to resolve Jira site", http.StatusBadGateway)
+		log.Println("site resolution error:", err)
+		return batchRun{}, false
+	}
+
+	user, _ := shared.UserFromContext(r.Context())
+	return batchRun{
+		keys:   keys,
+		client: client,
+		site:   site,
+		user:   user,
+		filter: commentFilter(r, JSONPayload{Start: payload.Start, End: payload.End}),
+	}, true
+}
+
+// transform generates the i-th issue's entry, turning a failure into the
+// result's error.
+func (b batchRun) transform(ctx context.Context, log *log.Logger, generator Generator, store Repository, i int, onText func(text string)) BatchResult {
+	result := BatchResult{Key: b.keys[i]}
+	entry, err := transformIssue(ctx, log, b.client, b.site, generator, store, b.user, b.keys[i], b.filter, onText)
+	if err != nil {
+		log.Printf("batch entry %s failed: %v\n", b.keys[i], err)
+		result.Error = transformErrorMessage(err)
+	} else {
+		result.Entry = &entry
+	}
+	return result
+}
+
+func (r *BatchResponse) count() {
+	r.Succeeded, r.Failed = 0, 0
+	for _, result := range r.Results {
+		if result.Error != "" {
+			r.Failed++
+		} else {
+			r.Succeeded++
+		}
+	}
+}
+
+// handleBatchTransform generates entries for several issues at once. A failed
+// issue is reported in its result rather than failing the whole batch.
+func handleBatchTransform(log *log.Logger, generator Generator, workers int, jiraConfig shared.JiraConfig, httpClient *http.Client, sessions *shared.Sessions, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		batch, ok := decodeBatch(w, r, log, jiraConfig, httpClient, sessions)
+		if !ok {
+			return
+		}
+
+		response := BatchResponse{Results: make([]BatchResult, len(batch.keys))}
+		forEachConcurrently(len(batch.keys), workers, func(i int) {
+			response.Results[i] = batch.transform(r.Context(), log, generator, store, i, nil)
+		})
+
+		if err := r.Context().Err(); err != nil {
+			log.Println("batch cancelled:", err)
+			return
+		}
+
+		response.count()
+		if err := shared.Encode(w, http.StatusOK, response); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEachConcurrently(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int
+		workers int
+		limit   int
+	}{
+		{name: "more items than workers", n: 20, workers: 3, limit: 3},
+		{name: "more workers than items", n: 2, workers: 8, limit: 2},
+		{name: "no workers means one", n: 5, workers: 0, limit: 1},
+		{name: "nothing to do", n: 0, workers: 4, limit: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			calls := make(map[int]int)
+			var running, peak atomic.Int32
+
+			forEachConcurrently(tt.n, tt.workers, func(i int) {
+				now := running.Add(1)
+				for {
+					old := peak.Load()
+					if now <= old || peak.CompareAndSwap(old, now) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				running.Add(-1)
+
+				mu.Lock()
+				calls[i]++
+				mu.Unlock()
+			})
+
+			if len(calls) != tt.n {
+				t.Errorf("called %d indexes, want %d", len(calls), tt.n)
+			}
+			for i, count := range calls {
+				if i < 0 || i >= tt.n || count != 1 {
+					t.Errorf("index %d called %d times", i, count)
+				}
+			}
+			if int(peak.Load()) > tt.limit {
+				t.Errorf("%d calls ran at once, want at most %d", peak.Load(), tt.limit)
+			}
+		})
+	}
+}
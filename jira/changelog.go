@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	changelogPageSize  = 100
+	changelogPageLimit = 20
+
+	statusCategoryInProgress = "indeterminate"
+
+	WindowAssigned   = "assigned"
+	WindowInProgress = "in_progress"
+
+	EventTransition = "transition"
+	EventEdit       = "edit"
+)
+
+// bookkeepingFields change when work is handed around or closed, not done,
+// so editing them doesn't put an issue in a month on its own.
+var bookkeepingFields = map[string]bool{
+	"assignee":   true,
+	"resolution": true,
+	"Sprint":     true,
+	"Rank":       true,
+}
+
+type ChangeItem struct {
+	Field      string `json:"field"`
+	From       string `json:"from"`
+	FromString string `json:"fromString"`
+	To         string `json:"to"`
+	ToString   string `json:"toString"`
+}
+
+type ChangeHistory struct {
+	Id      string       `json:"id"`
+	Author  JiraAccount  `json:"author"`
+	Created string       `json:"created"`
+	Items   []ChangeItem `json:"items"`
+}
+
+// jiraChangelog is what expand=changelog embeds in a search result. Jira cuts
+// it short on busy issues, so Total can be larger than len(Histories).
+type jiraChangelog struct {
+	StartAt   int             `json:"startAt"`
+	Total     int             `json:"total"`
+	Histories []ChangeHistory `json:"histories"`
+}
+
+type changelogPage struct {
+	StartAt int             `json:"startAt"`
+	Total   int             `json:"total"`
+	IsLast  bool            `json:"isLast"`
+	Values  []ChangeHistory `json:"values"`
+}
+
+// ActivityWindow is a stretch of time an issue spent in one state. End is nil
+// while the issue is still in it.
+type ActivityWindow struct {
+	Kind  string     `json:"kind"`
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+// ActivityEvent is a change the user made to the issue themselves.
+type ActivityEvent struct {
+	Kind  string    `json:"kind"`
+	Field string    `json:"field"`
+	From  string    `json:"from,omitempty"`
+	To    string    `json:"to,omitempty"`
+	At    time.Time `json:"at"`
+}
+
+// IssueActivity explains why an issue belongs to a reporting period. Reasons
+// are written for the auditors who ask; an issue with none didn't see any of
+// the user's work in the period.
+type IssueActivity struct {
+	Windows []ActivityWindow `json:"windows"`
+	Events  []ActivityEvent  `json:"events"`
+	Reasons []string         `json:"reasons"`
+}
+
+func (a IssueActivity) Qualifies() bool {
+	return len(a.Reasons) > 0
+}
+
+// completeChangelog pages through /changelog when the copy embedded in the
+// search result was truncated.
+func (c *JiraClient) completeChangelog(ctx context.Context, issue *jiraIssue) error {
+	if len(issue.Changelog.Histories) >= issue.Changelog.Total {
+		return nil
+	}
+
+	var histories []ChangeHistory
+	startAt := 0
+
+	for page := 0; page < changelogPageLimit; page++ {
+		query := url.Values{}
+		query.Set("startAt", strconv.Itoa(startAt))
+		query.Set("maxResults", strconv.Itoa(changelogPageSize))
+
+		var res changelogPage
+		if err := c.Get(ctx, "/rest/api/3/issue/"+issue.Key+"/changelog", query, &res); err != nil {
+			return err
+		}
+		histories = append(histories, res.Values...)
+
+		startAt += len(res.Values)
+		if res.IsLast || len(res.Values) == 0 || startAt >= res.Total {
+			issue.Changelog.Histories = histories
+			issue.Changelog.Total = len(histories)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("changelog for %s exceeded %d pages", issue.Key, changelogPageLimit)
+}
+
+// GetStatusCategories maps status ids to their category key (new,
+// indeterminate or done), which changelog entries don't carry.
+func (c *JiraClient) GetStatusCategories(ctx context.Context) (map[string]string, error) {
+	var statuses []jiraStatus
+	if err := c.Get(ctx, "/rest/api/3/status", nil, &statuses); err != nil {
+		return nil, err
+	}
+
+	categories := make(map[string]string, len(statuses))
+	for _, status := range statuses {
+		categories[status.Id] = status.StatusCategory.Key
+	}
+	return categories, nil
+}
+
+// buildActivity replays the changelog to find when the issue was assigned to
+// accountId and when it was in progress, and collects the user's own edits
+// during the period.
+func buildActivity(issue jiraIssue, accountId string, period Period, categories map[string]string) IssueActivity {
+	histories := append([]ChangeHistory(nil), issue.Changelog.Histories...)
+	sort.SliceStable(histories, func(i, j int) bool {
+		a, _ := parseJiraTime(histories[i].Created)
+		b, _ := parseJiraTime(histories[j].Created)
+		return a.Before(b)
+	})
+
+	// Undo every change, newest first, to get the state the issue was created in.
+	assignee := ""
+	if issue.Fields.Assignee != nil {
+		assignee = issue.Fields.Assignee.AccountId
+	}
+	status := issue.Fields.Status.Id
+	for i := len(histories) - 1; i >= 0; i-- {
+		for _, item := range histories[i].Items {
+			switch item.Field {
+			case "assignee":
+				assignee = item.From
+			case "status":
+				status = item.From
+			}
+		}
+	}
+
+	created, _ := parseJiraTime(issue.Fields.Created)
+	assigned := newWindowTracker(WindowAssigned, assignee == accountId, created)
+	progress := newWindowTracker(WindowInProgress, categories[status] == statusCategoryInProgress, created)
+
+	var activity IssueActivity
+	working := false
+	for _, history := range histories {
+		at, err := parseJiraTime(history.Created)
+		if err != nil {
+			continue
+		}
+		mine := accountId != "" && history.Author.AccountId == accountId && period.Contains(at)
+
+		for _, item := range history.Items {
+			switch item.Field {
+			case "assignee":
+				assigned.set(item.To == accountId, at)
+			case "status":
+				progress.set(categories[item.To] == statusCategoryInProgress, at)
+			}
+
+			if !mine {
+				continue
+			}
+			kind := EventEdit
+			if item.Field == "status" {
+				kind = EventTransition
+				// Closing an issue isn't creative work on its own.
+				working = working || categories[item.To] != "done"
+			}
+			activity.Events = append(activity.Events, ActivityEvent{
+				Kind:  kind,
+				Field: item.Field,
+				From:  item.FromString,
+				To:    item.ToString,
+				At:    at,
+			})
+		}
+	}
+
+	activity.Windows = append(assigned.close(), progress.close()...)
+	activity.Reasons = activityReasons(activity, period, working)
+	return activity
+}
+
+func activityReasons(activity IssueActivity, period Period, working bool) []string {
+	var reasons []string
+	periodEnd := period.End.AddDate(0, 0, 1)
+
+	for _, assigned := range activity.Windows {
+		if assigned.Kind != WindowAssigned {
+			continue
+		}
+		for _, progress := range activity.Windows {
+			if progress.Kind != WindowInProgress {
+				continue
+			}
+			start := latest(assigned.Start, progress.Start, period.Start)
+			end := earliest(windowEnd(assigned, periodEnd), windowEnd(progress, periodEnd), periodEnd)
+			if start.Before(end) {
+				reasons = append(reasons, fmt.Sprintf(
+					"In progress while assigned to you from %s to %s",
+					start.Format(issueDateLayout),
+					end.Add(-time.Nanosecond).Format(issueDateLayout),
+				))
+			}
+		}
+	}
+
+	var transitions []string
+	var fields []string
+	seen := map[string]bool{}
+	for _, event := range activity.Events {
+		switch event.Kind {
+		case EventTransition:
+			if event.To != "" {
+				transitions = append(transitions, fmt.Sprintf("%s → %s on %s", event.From, event.To, event.At.Format(issueDateLayout)))
+			}
+		case EventEdit:
+			if !bookkeepingFields[event.Field] && !seen[event.Field] {
+				seen[event.Field] = true
+				fields = append(fields, event.Field)
+			}
+		}
+	}
+	if working && len(transitions) > 0 {
+		reasons = append(reasons, "Transitioned by you: "+strings.Join(transitions, ", "))
+	}
+	if len(fields) > 0 {
+		reasons = append(reasons, "Edited by you: "+strings.Join(fields, ", "))
+	}
+	return reasons
+}
+
+type windowTracker struct {
+	kind    string
+	open    bool
+	since   time.Time
+	windows []ActivityWindow
+}
+
+func newWindowTracker(kind string, open bool, since time.Time) *windowTracker {
+	return &windowTracker{kind: kind, open: open, since: since}
+}
+
+func (t *windowTracker) set(open bool, at time.Time) {
+	if open == t.open {
+		return
+	}
+	if t.open {
+		end := at
+		t.windows = append(t.windows, ActivityWindow{Kind: t.kind, Start: t.since, End: &end})
+	}
+	t.open = open
+	t.since = at
+}
+
+func (t *windowTracker) close() []ActivityWindow {
+	if t.open {
+		t.windows = append(t.windows, ActivityWindow{Kind: t.kind, Start: t.since})
+	}
+	return t.windows
+}
+
+func windowEnd(window ActivityWindow, fallback time.Time) time.Time {
+	if window.End == nil {
+		return fallback
+	}
+	return *window.End
+}
+
+func latest(times ...time.Time) time.Time {
+	result := times[0]
+	for _, t := range times[1:] {
+		if t.After(result) {
+			result = t
+		}
+	}
+	return result
+}
+
+func earliest(times ...time.Time) time.Time {
+	result := times[0]
+	for _, t := range times[1:] {
+		if t.Before(result) {
+			result = t
+		}
+	}
+	return result
+}
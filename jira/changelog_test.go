@@ -0,0 +1,165 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testDay(d int) time.Time {
+	return time.Date(2025, 1, d, 9, 0, 0, 0, time.UTC)
+}
+
+func testWindow(kind string, start time.Time, end *time.Time) ActivityWindow {
+	return ActivityWindow{Kind: kind, Start: start, End: end}
+}
+
+func TestWindowTracker(t *testing.T) {
+	at := func(d int) *time.Time {
+		end := testDay(d)
+		return &end
+	}
+
+	tests := []struct {
+		name    string
+		open    bool
+		changes []bool
+		want    []ActivityWindow
+	}{
+		{
+			name: "never opened",
+			want: nil,
+		},
+		{
+			name: "open from creation",
+			open: true,
+			want: []ActivityWindow{testWindow(WindowAssigned, testDay(1), nil)},
+		},
+		{
+			name:    "opened and closed",
+			changes: []bool{true, false},
+			want:    []ActivityWindow{testWindow(WindowAssigned, testDay(2), at(3))},
+		},
+		{
+			name:    "repeated states are ignored",
+			open:    true,
+			changes: []bool{true, false, false, true},
+			want: []ActivityWindow{
+				testWindow(WindowAssigned, testDay(1), at(3)),
+				testWindow(WindowAssigned, testDay(5), nil),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newWindowTracker(WindowAssigned, tt.open, testDay(1))
+			for i, open := range tt.changes {
+				tracker.set(open, testDay(i+2))
+			}
+			if got := tracker.close(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("close() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testHistory(author string, created time.Time, items ...ChangeItem) ChangeHistory {
+	return ChangeHistory{
+		Author:  JiraAccount{AccountId: author},
+		Created: created.Format(jiraTimeLayout),
+		Items:   items,
+	}
+}
+
+func TestBuildActivity(t *testing.T) {
+	period := Period{Start: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)}
+	categories := map[string]string{"1": "new", "3": statusCategoryInProgress, "5": "done"}
+
+	newIssue := func(histories ...ChangeHistory) jiraIssue {
+		var issue jiraIssue
+		issue.Fields.Created = time.Date(2024, 12, 1, 9, 0, 0, 0, time.UTC).Format(jiraTimeLayout)
+		issue.Fields.Status.Id = "1"
+		issue.Changelog.Histories = histories
+		// The current state is whatever the last change left.
+		for _, h := range histories {
+			for _, item := range h.Items {
+				switch item.Field {
+				case "status":
+					issue.Fields.Status.Id = item.To
+				case "assignee":
+					issue.Fields.Assignee = &JiraAccount{AccountId: item.To}
+				}
+			}
+		}
+		return issue
+	}
+
+	tests := []struct {
+		name       string
+		issue      jiraIssue
+		qualifies  bool
+		wantReason string
+	}{
+		{
+			name: "in progress while assigned",
+			issue: newIssue(
+				testHistory("lead", testDay(2), ChangeItem{Field: "assignee", To: "me"}),
+				testHistory("me", testDay(5), ChangeItem{Field: "status", From: "1", FromString: "To Do", To: "3", ToString: "In Progress"}),
+				testHistory("me", testDay(20), ChangeItem{Field: "status", From: "3", FromString: "In Progress", To: "5", ToString: "Done"}),
+			),
+			qualifies:  true,
+			wantReason: "In progress while assigned to you from 2025-01-05 to 2025-01-20",
+		},
+		{
+			name: "in progress before the month only",
+			issue: newIssue(
+				testHistory("me", time.Date(2024, 12, 2, 9, 0, 0, 0, time.UTC), ChangeItem{Field: "assignee", To: "me"}),
+				testHistory("me", time.Date(2024, 12, 3, 9, 0, 0, 0, time.UTC), ChangeItem{Field: "status", From: "1", To: "3"}),
+				testHistory("me", time.Date(2024, 12, 20, 9, 0, 0, 0, time.UTC), ChangeItem{Field: "status", From: "3", To: "5"}),
+			),
+			qualifies: false,
+		},
+		{
+			name: "someone else's work",
+			issue: newIssue(
+				testHistory("other", testDay(2), ChangeItem{Field: "assignee", To: "other"}),
+				testHistory("other", testDay(5), ChangeItem{Field: "status", From: "1", To: "3"}),
+			),
+			qualifies: false,
+		},
+		{
+			name: "closing alone is not work",
+			issue: newIssue(
+				testHistory("me", testDay(5), ChangeItem{Field: "status", From: "1", FromString: "To Do", To: "5", ToString: "Done"}),
+			),
+			qualifies: false,
+		},
+		{
+			name: "bookkeeping edits are not work",
+			issue: newIssue(
+				testHistory("me", testDay(5), ChangeItem{Field: "Sprint", To: "2"}, ChangeItem{Field: "Rank"}),
+			),
+			qualifies: false,
+		},
+		{
+			name: "own edits",
+			issue: newIssue(
+				testHistory("me", testDay(5), ChangeItem{Field: "description"}, ChangeItem{Field: "summary"}, ChangeItem{Field: "description"}),
+			),
+			qualifies:  true,
+			wantReason: "Edited by you: description, summary",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			activity := buildActivity(tt.issue, "me", period, categories)
+			if activity.Qualifies() != tt.qualifies {
+				t.Fatalf("Qualifies() = %v, reasons %q", activity.Qualifies(), activity.Reasons)
+			}
+			if tt.wantReason != "" && !strings.Contains(strings.Join(activity.Reasons, "\n"), tt.wantReason) {
+				t.Errorf("reasons = %q, want %q", activity.Reasons, tt.wantReason)
+			}
+		})
+	}
+}
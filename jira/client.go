@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	jiraRequestTimeout = 30 * time.Second
+	jiraTimeLayout     = "2006-01-02T15:04:05.000-0700"
+)
+
+type JiraError struct {
+	StatusCode int
+	Messages   []string
+}
+
+func (e *JiraError) Error() string {
+	if len(e.Messages) == 0 {
+		return fmt.Sprintf("jira responded with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("jira responded with status %d: %s", e.StatusCode, strings.Join(e.Messages, "; "))
+}
+
+type JiraClient struct {
+	http          *http.Client
+	baseUrl       string
+	authorization string
+}
+
+func NewJiraClient(httpClient *http.Client, baseUrl string, authorization string) *JiraClient {
+	return &JiraClient{
+		http:          httpClient,
+		baseUrl:       strings.TrimSuffix(baseUrl, "/"),
+		authorization: authorization,
+	}
+}
+
+func NewJiraHttpClient() *http.Client {
+	return &http.Client{Timeout: jiraRequestTimeout}
+}
+
+func (c *JiraClient) Get(ctx context.Context, path string, query url.Values, v any) error {
+	endpoint := c.baseUrl + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("build jira request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", c.authorization)
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("jira request %s: %w", path, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return decodeJiraError(res)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode jira response %s: %w", path, err)
+	}
+	return nil
+}
+
+func decodeJiraError(res *http.Response) error {
+	jiraErr := &JiraError{StatusCode: res.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+
+	var details struct {
+		ErrorMessages []string          `json:"errorMessages"`
+		Errors        map[string]string `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &details); err == nil {
+		jiraErr.Messages = append(jiraErr.Messages, details.ErrorMessages...)
+		for field, message := range details.Errors {
+			jiraErr.Messages = append(jiraErr.Messages, field+": "+message)
+		}
+	} else if len(body) > 0 {
+		jiraErr.Messages = append(jiraErr.Messages, string(body))
+	}
+	return jiraErr
+}
+
+// parseJiraTime reads the timestamp format Jira uses for created, updated and
+// started fields.
+func parseJiraTime(value string) (time.Time, error) {
+	return time.Parse(jiraTimeLayout, value)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	commentPageSize  = 100
+	commentPageLimit = 20
+	// commentBudget caps how much comment text goes into a prompt, in bytes.
+	commentBudget = 12000
+)
+
+type Comment struct {
+	Id      string
+	Author  JiraAccount
+	Created time.Time
+	Body    string
+}
+
+type jiraComment struct {
+	Id      string          `json:"id"`
+	Author  JiraAccount     `json:"author"`
+	Body    json.RawMessage `json:"body"`
+	Created string          `json:"created"`
+}
+
+type commentPage struct {
+	StartAt    int           `json:"startAt"`
+	MaxResults int           `json:"maxResults"`
+	Total      int           `json:"total"`
+	Comments   []jiraComment `json:"comments"`
+}
+
+// CommentFilter keeps comments written by AccountId or posted during Period.
+// A zero filter keeps everything.
+type CommentFilter struct {
+	AccountId string
+	Period    *Period
+}
+
+func (f CommentFilter) keep(comment Comment) bool {
+	if f.AccountId == "" && f.Period == nil {
+		return true
+	}
+	if f.AccountId != "" && comment.Author.AccountId == f.AccountId {
+		return true
+	}
+	return f.Period != nil && f.Period.Contains(comment.Created)
+}
+
+func (c *JiraClient) GetComments(ctx context.Context, key string, filter CommentFilter) ([]Comment, error) {
+	if !issueKeyPattern.MatchString(key) {
+		return nil, fmt.Errorf("invalid issue key %q", key)
+	}
+
+	var comments []Comment
+	startAt := 0
+
+	for page := 0; page < commentPageLimit; page++ {
+		query := url.Values{}
+		query.Set("startAt", strconv.Itoa(startAt))
+		query.Set("maxResults", strconv.Itoa(commentPageSize))
+		query.Set("orderBy", "created")
+
+		var res commentPage
+		if err := c.Get(ctx, "/rest/api/3/issue/"+key+"/comment", query, &res); err != nil {
+			return nil, err
+		}
+
+		for _, raw := range res.Comments {
+			created, _ := parseJiraTime(raw.Created)
+			comment := Comment{
+				Id:      raw.Id,
+				Author:  raw.Author,
+				Created: created,
+				Body:    adfToMarkdown(raw.Body),
+			}
+			if comment.Body != "" && filter.keep(comment) {
+				comments = append(comments, comment)
+			}
+		}
+
+		startAt += len(res.Comments)
+		if len(res.Comments) == 0 || startAt >= res.Total {
+			return comments, nil
+		}
+	}
+
+	return comments, fmt.Errorf("comments for %s exceeded %d pages", key, commentPageLimit)
+}
+
+// commentsForPrompt renders comments oldest first, dropping the oldest ones
+// when the total would go over budget so the latest discussion survives.
+func commentsForPrompt(comments []Comment, budget int) string {
+	sorted := append([]Comment(nil), comments...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Created.Before(sorted[j].Created)
+	})
+
+	var kept []string
+	used := 0
+	for i := len(sorted) - 1; i >= 0; i-- {
+		comment := sorted[i]
+		entry := fmt.Sprintf("%s (%s):\n%s", comment.Author.DisplayName, comment.Created.Format(issueDateLayout), comment.Body)
+		if used+len(entry) > budget {
+			if used == 0 {
+				kept = append(kept, truncateText(entry, budget))
+			}
+			break
+		}
+		kept = append(kept, entry)
+		used += len(entry)
+	}
+
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	return strings.Join(kept, "\n\n")
+}
+
+// truncateText cuts text to at most limit bytes without splitting a rune.
+func truncateText(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut]
+}
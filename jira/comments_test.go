@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func testComment(author string, day int, body string) Comment {
+	return Comment{
+		Author:  JiraAccount{AccountId: strings.ToLower(author), DisplayName: author},
+		Created: time.Date(2025, 1, day, 12, 0, 0, 0, time.UTC),
+		Body:    body,
+	}
+}
+
+func TestCommentsForPrompt(t *testing.T) {
+	ann := "Ann (2025-01-01):\nfirst"
+	bob := "Bob (2025-01-02):\nsecond"
+	cat := "Cat (2025-01-03):\nthird"
+	comments := []Comment{
+		testComment("Cat", 3, "third"),
+		testComment("Ann", 1, "first"),
+		testComment("Bob", 2, "second"),
+	}
+
+	tests := []struct {
+		name   string
+		budget int
+		want   string
+	}{
+		{name: "all fit, oldest first", budget: 1000, want: ann + "\n\n" + bob + "\n\n" + cat},
+		{name: "exactly fits", budget: len(ann) + len(bob) + len(cat), want: ann + "\n\n" + bob + "\n\n" + cat},
+		{name: "oldest dropped first", budget: len(bob) + len(cat), want: bob + "\n\n" + cat},
+		{name: "only the latest", budget: len(cat) + 1, want: cat},
+		{name: "latest truncated when nothing fits", budget: 10, want: cat[:10]},
+		{name: "no budget", budget: 0, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := commentsForPrompt(comments, tt.budget); got != tt.want {
+				t.Errorf("commentsForPrompt() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+
+	if got := commentsForPrompt(nil, commentBudget); got != "" {
+		t.Errorf("no comments = %q, want empty", got)
+	}
+	if comments[0].Author.DisplayName != "Cat" {
+		t.Error("commentsForPrompt reordered its argument")
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		text  string
+		limit int
+		want  string
+	}{
+		{text: "short", limit: 10, want: "short"},
+		{text: "exact", limit: 5, want: "exact"},
+		{text: "abcdef", limit: 3, want: "abc"},
+		// "é" is two bytes; cutting through it keeps neither half.
+		{text: "aé", limit: 2, want: "a"},
+		{text: "日本", limit: 4, want: "日"},
+	}
+	for _, tt := range tests {
+		if got := truncateText(tt.text, tt.limit); got != tt.want {
+			t.Errorf("truncateText(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestCommentFilterKeep(t *testing.T) {
+	period := Period{
+		Start: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC),
+	}
+	mine := Comment{Author: JiraAccount{AccountId: "me"}, Created: time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)}
+	inPeriod := Comment{Author: JiraAccount{AccountId: "other"}, Created: time.Date(2025, 1, 31, 23, 0, 0, 0, time.UTC)}
+	outside := Comment{Author: JiraAccount{AccountId: "other"}, Created: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name    string
+		filter  CommentFilter
+		comment Comment
+		want    bool
+	}{
+		{name: "zero filter keeps all", filter: CommentFilter{}, comment: outside, want: true},
+		{name: "own comment outside period", filter: CommentFilter{AccountId: "me", Period: &period}, comment: mine, want: true},
+		{name: "other's comment on the last day", filter: CommentFilter{AccountId: "me", Period: &period}, comment: inPeriod, want: true},
+		{name: "other's comment after the period", filter: CommentFilter{AccountId: "me", Period: &period}, comment: outside, want: false},
+		{name: "account only", filter: CommentFilter{AccountId: "me"}, comment: inPeriod, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.keep(tt.comment); got != tt.want {
+				t.Errorf("keep() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"JiraConnect/shared"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type CredentialPayload struct {
+	Email string `json:"email"`
+	Token string `json:"token"`
+	Site  string `json:"site"`
+}
+
+// handleAddApiToken accepts an email + API token once and keeps it in the
+// server session. It attaches to an existing OAuth session when there is one,
+// otherwise it starts a new session on its own.
+func handleAddApiToken(log *log.Logger, sessions *shared.Sessions, verifier *shared.TokenVerifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload CredentialPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid JSON payload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		payload.Email = strings.TrimSpace(payload.Email)
+		payload.Token = strings.TrimSpace(payload.Token)
+		if payload.Email == "" || payload.Token == "" {
+			http.Error(w, "email and token are required", http.StatusBadRequest)
+			return
+		}
+
+		siteUrl, err := shared.NormaliseSiteUrl(payload.Site)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		token := shared.ApiToken{Email: payload.Email, Token: payload.Token, SiteUrl: siteUrl}
+		if _, err := verifier.Verify(r.Context(), shared.Session{ApiToken: &token}); err != nil {
+			if errors.Is(err, shared.ErrTokenRejected) {
+				http.Error(w, "Jira rejected the API token", http.StatusUnauthorized)
+			} else {
+				http.Error(w, "Unable to reach Jira", http.StatusBadGateway)
+			}
+			log.Println("api token verification error:", err)
+			return
+		}
+
+		// The change is made under the session's lock, so a token refresh
+		// running alongside isn't overwritten.
+		session, err := sessions.Load(r.Context(), r)
+		if err == nil {
+			session, err = sessions.Update(r.Context(), session.Id, func(session *shared.Session) {
+				session.ApiToken = &token
+			})
+		} else {
+			session, err = sessions.StartApiToken(r.Context(), w, r, token)
+		}
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println("unable to store api token:", err)
+			return
+		}
+
+		if err := shared.Encode(w, http.StatusOK, session.Info()); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
+
+// handleRemoveApiToken drops the API token, falling back to OAuth when the
+// session has it and ending the session when it doesn't.
+func handleRemoveApiToken(log *log.Logger, sessions *shared.Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current, _ := shared.SessionFromContext(r.Context())
+		session, err := sessions.Update(r.Context(), current.Id, func(session *shared.Session) {
+			session.ApiToken = nil
+		})
+		if err == nil && session.Token.AccessToken == "" {
+			err = sessions.End(r.Context(), w, session)
+		}
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println("unable to remove api token:", err)
+			return
+		}
+
+		if err := shared.Encode(w, http.StatusOK, session.Info()); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
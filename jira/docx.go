@@ -0,0 +1,179 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A minimal WordprocessingML writer: styled paragraphs, rules, hyperlinks and
+// page breaks, zipped up as a .docx that Word and LibreOffice open for
+// editing.
+
+const (
+	docxStyleTitle   = "Title"
+	docxStyleHeading = "Heading1"
+	docxStyleLabel   = "Label"
+	docxStyleMeta    = "Meta"
+)
+
+const docxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>
+<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>
+</Types>`
+
+const docxPackageRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>
+</Relationships>`
+
+const docxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:docDefaults>
+<w:rPrDefault><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Calibri" w:eastAsia="Calibri" w:cs="Calibri"/><w:sz w:val="22"/><w:szCs w:val="22"/><w:lang w:val="en-GB"/></w:rPr></w:rPrDefault>
+<w:pPrDefault><w:pPr><w:spacing w:after="120" w:line="276" w:lineRule="auto"/></w:pPr></w:pPrDefault>
+</w:docDefaults>
+<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/><w:qFormat/></w:style>
+<w:style w:type="paragraph" w:styleId="Title"><w:name w:val="Title"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:spacing w:after="360"/></w:pPr><w:rPr><w:b/><w:sz w:val="40"/><w:szCs w:val="40"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Heading1"><w:name w:val="heading 1"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:keepNext/><w:spacing w:before="240" w:after="40"/><w:outlineLvl w:val="0"/></w:pPr><w:rPr><w:b/><w:sz w:val="26"/><w:szCs w:val="26"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Label"><w:name w:val="Label"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:pPr><w:keepNext/><w:spacing w:after="0"/></w:pPr><w:rPr><w:b/><w:sz w:val="18"/><w:szCs w:val="18"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Meta"><w:name w:val="Meta"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:rPr><w:color w:val="666666"/><w:sz w:val="17"/><w:szCs w:val="17"/></w:rPr></w:style>
+<w:style w:type="character" w:styleId="Hyperlink"><w:name w:val="Hyperlink"/><w:rPr><w:color w:val="0000CC"/><w:u w:val="single"/></w:rPr></w:style>
+</w:styles>`
+
+// DOCXDocument collects body paragraphs and the hyperlink targets they refer
+// to.
+type DOCXDocument struct {
+	Title  string
+	Author string
+
+	body  bytes.Buffer
+	links []string
+}
+
+func NewDOCXDocument(title string, author string) *DOCXDocument {
+	return &DOCXDocument{Title: title, Author: author}
+}
+
+func xmlEscape(text string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// docxRuns writes text as runs, turning line breaks into <w:br/>.
+func docxRuns(text string, runProperties string) string {
+	var b strings.Builder
+	for i, line := range strings.Split(text, "\n") {
+		b.WriteString("<w:r>" + runProperties)
+		if i > 0 {
+			b.WriteString("<w:br/>")
+		}
+		fmt.Fprintf(&b, `<w:t xml:space="preserve">%s</w:t></w:r>`, xmlEscape(line))
+	}
+	return b.String()
+}
+
+func docxParagraphProperties(style string) string {
+	if style == "" {
+		return ""
+	}
+	return fmt.Sprintf(`<w:pPr><w:pStyle w:val="%s"/></w:pPr>`, style)
+}
+
+// Paragraph writes text in the given paragraph style, or Normal when style
+// is empty.
+func (d *DOCXDocument) Paragraph(text string, style string) {
+	fmt.Fprintf(&d.body, "<w:p>%s%s</w:p>\n", docxParagraphProperties(style), docxRuns(text, ""))
+}
+
+// Link writes text that opens url when clicked.
+func (d *DOCXDocument) Link(text string, url string) {
+	d.links = append(d.links, url)
+	// rId1 is the styles part, so hyperlinks start at rId2.
+	fmt.Fprintf(&d.body, `<w:p><w:hyperlink r:id="rId%d">%s</w:hyperlink></w:p>`+"\n",
+		len(d.links)+1, docxRuns(text, `<w:rPr><w:rStyle w:val="Hyperlink"/></w:rPr>`))
+}
+
+// Rule draws a line under an empty paragraph.
+func (d *DOCXDocument) Rule() {
+	d.body.WriteString(`<w:p><w:pPr><w:pBdr><w:bottom w:val="single" w:sz="4" w:space="1" w:color="999999"/></w:pBdr></w:pPr></w:p>` + "\n")
+}
+
+func (d *DOCXDocument) PageBreak() {
+	d.body.WriteString(`<w:p><w:r><w:br w:type="page"/></w:r></w:p>` + "\n")
+}
+
+// Bytes zips the document parts together.
+func (d *DOCXDocument) Bytes(created time.Time) ([]byte, error) {
+	var rels strings.Builder
+	rels.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	rels.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + "\n")
+	rels.WriteString(`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` + "\n")
+	for i, url := range d.links {
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="%s" TargetMode="External"/>`+"\n",
+			i+2, xmlEscape(url))
+	}
+	rels.WriteString(`</Relationships>`)
+
+	// A4 with 2cm margins, in twentieths of a point.
+	document := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<w:body>
+` + d.body.String() + `<w:sectPr><w:pgSz w:w="11906" w:h="16838"/><w:pgMar w:top="1134" w:right="1134" w:bottom="1134" w:left="1134" w:header="709" w:footer="709" w:gutter="0"/></w:sectPr>
+</w:body>
+</w:document>`
+
+	core := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<dc:title>%s</dc:title>
+<dc:creator>%s</dc:creator>
+<dcterms:created xsi:type="dcterms:W3CDTF">%s</dcterms:created>
+</cp:coreProperties>`, xmlEscape(d.Title), xmlEscape(d.Author), created.UTC().Format(time.RFC3339))
+
+	return packageOpenXML([]openXMLPart{
+		{"[Content_Types].xml", docxContentTypes},
+		{"_rels/.rels", docxPackageRels},
+		{"docProps/core.xml", core},
+		{"word/document.xml", document},
+		{"word/styles.xml", docxStyles},
+		{"word/_rels/document.xml.rels", rels.String()},
+	}, created)
+}
+
+// openXMLPart is one file inside a .docx or .xlsx package.
+type openXMLPart struct {
+	name    string
+	content string
+}
+
+// packageOpenXML zips parts in order; [Content_Types].xml should come first.
+func packageOpenXML(parts []openXMLPart, created time.Time) ([]byte, error) {
+	var out bytes.Buffer
+	archive := zip.NewWriter(&out)
+	for _, part := range parts {
+		file, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     part.name,
+			Method:   zip.Deflate,
+			Modified: created,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("add %s: %w", part.name, err)
+		}
+		if _, err := file.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("write %s: %w", part.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("close package: %w", err)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openXMLParts unzips a .docx or .xlsx, checking every XML part is well
+// formed.
+func openXMLParts(t *testing.T, out []byte) map[string]string {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := make(map[string]string)
+	for i, file := range archive.File {
+		if i == 0 && file.Name != "[Content_Types].xml" {
+			t.Errorf("first part is %s, want [Content_Types].xml", file.Name)
+		}
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoder := xml.NewDecoder(bytes.NewReader(raw))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s is not well formed: %v", file.Name, err)
+			}
+		}
+		parts[file.Name] = string(raw)
+	}
+	return parts
+}
+
+func TestDOCXDocumentBytes(t *testing.T) {
+	doc := NewDOCXDocument("Report <draft>", "Ann & Bob")
+	doc.Paragraph("Title", docxStyleTitle)
+	doc.Paragraph("first line\nsecond <line>", "")
+	doc.Link("one", "https://example.com/a?x=1&y=2")
+	doc.Link("two", "https://example.com/b")
+	doc.Rule()
+	doc.PageBreak()
+
+	out, err := doc.Bytes(time.Date(2025, 2, 1, 9, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := openXMLParts(t, out)
+
+	document := parts["word/document.xml"]
+	for _, want := range []string{
+		`<w:pStyle w:val="Title"/>`,
+		`first line</w:t></w:r><w:r><w:br/><w:t xml:space="preserve">second &lt;line&gt;`,
+		`<w:hyperlink r:id="rId2">`,
+		`<w:hyperlink r:id="rId3">`,
+		`<w:br w:type="page"/>`,
+	} {
+		if !strings.Contains(document, want) {
+			t.Errorf("document.xml is missing %q", want)
+		}
+	}
+
+	rels := parts["word/_rels/document.xml.rels"]
+	for _, want := range []string{
+		`Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles"`,
+		`Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="https://example.com/a?x=1&amp;y=2"`,
+		`Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="https://example.com/b"`,
+	} {
+		if !strings.Contains(rels, want) {
+			t.Errorf("document.xml.rels is missing %q", want)
+		}
+	}
+
+	core := parts["docProps/core.xml"]
+	for _, want := range []string{"<dc:title>Report &lt;draft&gt;</dc:title>", "<dc:creator>Ann &amp; Bob</dc:creator>", "2025-02-01T09:00:00Z"} {
+		if !strings.Contains(core, want) {
+			t.Errorf("core.xml is missing %q", want)
+		}
+	}
+}
+
+func TestRenderReportDOCX(t *testing.T) {
+	out, err := renderReportDOCX(testReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := openXMLParts(t, out)
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "word/document.xml", "word/styles.xml", "word/_rels/document.xml.rels", "docProps/core.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("package is missing %s", name)
+		}
+	}
+	if document := parts["word/document.xml"]; !strings.Contains(document, "Designed the import pipeline") || !strings.Contains(document, "Reworked the export") {
+		t.Error("document.xml is missing the entries")
+	}
+}
+
+func TestRenderReportMarkdown(t *testing.T) {
+	out, err := renderReportMarkdown(testReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	markdown := string(out)
+	for _, want := range []string{
+		"### **Designed the import pipeline**",
+		"Worked out how files are matched.\nWrote the parser.\n\n**Links:**  \n[https://example.atlassian.net/browse/ABC-1](https://example.atlassian.net/browse/ABC-1)",
+		"### **Reworked the export**",
+	} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("markdown is missing %q", want)
+		}
+	}
+	// The issue itself is always linked, and only once.
+	if strings.Count(markdown, "(https://example.atlassian.net/browse/ABC-1)") != 1 || !strings.Contains(markdown, "(https://example.atlassian.net/browse/ABC-2)") {
+		t.Error("each entry should link its issue exactly once")
+	}
+}
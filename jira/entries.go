@@ -0,0 +1,166 @@
+package main
+
+import (
+	"JiraConnect/shared"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EntryPayload is what the page may set on an entry. Everything else is
+// owned by the service.
+type EntryPayload struct {
+	Key         string   `json:"key"`
+	Url         string   `json:"url"`
+	Heading     string   `json:"heading"`
+	Description string   `json:"description"`
+	Links       []string `json:"links"`
+	Hours       float64  `json:"hours"`
+	// Revision is the revision an edit was made against. When set, the edit
+	// is refused if someone saved a newer one in the meantime.
+	Revision int `json:"revision"`
+}
+
+// createEntry stores a new entry along with its first revision.
+func createEntry(ctx context.Context, store Repository, entry *Entry, source string, author shared.User) error {
+	id, err := newRecordId()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	entry.Id = id
+	entry.Revision = 1
+	entry.Source = source
+	entry.CreatedAt = now
+	entry.UpdatedAt = now
+	if entry.Links == nil {
+		entry.Links = []string{}
+	}
+	if err := store.SaveEntry(ctx, *entry); err != nil {
+		return err
+	}
+	return store.SaveRevision(ctx, snapshot(*entry, source, author))
+}
+
+// refreshReport recounts a report after one of its entries changed. Entries
+// that aren't part of a report are left alone.
+func refreshReport(ctx context.Context, store Repository, reportId string) error {
+	if reportId == "" {
+		return nil
+	}
+	report, err := store.GetReport(ctx, reportId)
+	if err != nil {
+		return err
+	}
+	report.Totals, report.Links = reportTotals(report.Entries, report.Totals.Hours)
+	report.UpdatedAt = time.Now().UTC()
+	return store.SaveReport(ctx, report)
+}
+
+func ownedEntry(ctx context.Context, store Repository, id string, accountId string) (Entry, error) {
+	entry, err := store.GetEntry(ctx, id)
+	if err != nil {
+		return entry, err
+	}
+	if entry.AccountId != accountId {
+		return Entry{}, ErrNotFound
+	}
+	return entry, nil
+}
+
+func handleListEntries(log *log.Logger, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := shared.UserFromContext(r.Context())
+		params := r.URL.Query()
+		entries, err := store.ListEntries(r.Context(), EntryFilter{
+			AccountId: user.AccountId,
+			ReportId:  params.Get("report"),
+			Key:       params.Get("key"),
+		})
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		if err := shared.Encode(w, http.StatusOK, entries); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
+
+// handleCreateEntry stores an entry written or pasted in by hand rather than
+// generated.
+func handleCreateEntry(log *log.Logger, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload EntryPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid JSON payload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(payload.Heading) == "" && strings.TrimSpace(payload.Description) == "" {
+			http.Error(w, "heading or description is required", http.StatusBadRequest)
+			return
+		}
+
+		user, _ := shared.UserFromContext(r.Context())
+		entry := Entry{
+			AccountId:   user.AccountId,
+			Key:         payload.Key,
+			Url:         payload.Url,
+			Heading:     payload.Heading,
+			Description: payload.Description,
+			Links:       payload.Links,
+			Hours:       payload.Hours,
+		}
+		if err := createEntry(r.Context(), store, &entry, RevisionSourceHuman, user); err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		if err := shared.Encode(w, http.StatusCreated, entry); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
+
+func handleGetEntry(log *log.Logger, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := shared.UserFromContext(r.Context())
+		entry, err := ownedEntry(r.Context(), store, r.PathValue("id"), user.AccountId)
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		if err := shared.Encode(w, http.StatusOK, entry); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
+
+func handleDeleteEntry(log *log.Logger, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := shared.UserFromContext(r.Context())
+		entry, err := ownedEntry(r.Context(), store, r.PathValue("id"), user.AccountId)
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		if err := store.DeleteEntry(r.Context(), entry.Id); err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+		if err := refreshReport(r.Context(), store, entry.ReportId); err != nil {
+			log.Println("unable to update report totals:", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ProviderGemini = "gemini"
+	ProviderOpenAI = "openai"
+	ProviderFake   = "fake"
+)
+
+type LLMConfig struct {
+	// Provider picks the Generator: gemini, openai (any OpenAI-compatible
+	// server, including Ollama and llama.cpp) or fake.
+	Provider string
+	Model    string
+	// Endpoint overrides the provider's base URL.
+	Endpoint string
+	ApiKey   string
+	// RateLimit is the most calls a minute made to the provider. 0 means
+	// unlimited and a negative value the provider's default.
+	RateLimit int
+	// Workers is how many issues a batch generates at once.
+	Workers int
+}
+
+// defaultRateLimits keep within the providers' free tiers. Local servers
+// and the fake are not limited.
+var defaultRateLimits = map[string]int{
+	"":             15,
+	ProviderGemini: 15,
+}
+
+// Prompt is what a Generator is asked to write an entry from.
+type Prompt struct {
+	// Text is the full prompt, style guide included.
+	Text string
+	// Content is what Text was built from.
+	Content IssueContent
+}
+
+// Generator writes an entry for one issue. Implementations differ only in
+// which model they call; the prompt and the shape of the answer are the same
+// for all of them.
+type Generator interface {
+	Generate(ctx context.Context, prompt Prompt) (LLMResponse, error)
+}
+
+// StreamingGenerator is a Generator that can also hand over the answer's
+// text as the model writes it.
+type StreamingGenerator interface {
+	Generator
+	GenerateStream(ctx context.Context, prompt Prompt, onText func(text string)) (LLMResponse, error)
+}
+
+// generate streams to onText when it is set and the generator can, and
+// otherwise waits for the whole answer.
+func generate(ctx context.Context, generator Generator, prompt Prompt, onText func(text string)) (LLMResponse, error) {
+	if streaming, ok := generator.(StreamingGenerator); ok && onText != nil {
+		return streaming.GenerateStream(ctx, prompt, onText)
+	}
+	return generator.Generate(ctx, prompt)
+}
+
+func NewGenerator(ctx context.Context, config LLMConfig) (Generator, error) {
+	var generator Generator
+	var err error
+	switch config.Provider {
+	case "", ProviderGemini:
+		generator, err = NewGeminiGenerator(ctx, config)
+	case ProviderOpenAI:
+		generator, err = NewOpenAIGenerator(config)
+	case ProviderFake:
+		generator = FakeGenerator{}
+	default:
+		return nil, fmt.Errorf("unknown llm provider %q", config.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	limit := config.RateLimit
+	if limit < 0 {
+		limit = defaultRateLimits[config.Provider]
+	}
+	if limit > 0 {
+		generator = &RateLimitedGenerator{Generator: generator, limiter: NewRateLimiter(limit)}
+	}
+	return generator, nil
+}
+
+// RateLimiter spaces calls evenly so no more than perMinute start in any
+// minute.
+type RateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+	// freed are turns given back by cancelled callers, earliest first. Later
+	// callers take them before queueing at next.
+	freed []time.Time
+}
+
+func NewRateLimiter(perMinute int) *RateLimiter {
+	return &RateLimiter{interval: time.Minute / time.Duration(perMinute)}
+}
+
+// Wait blocks until the caller's turn, or until ctx is done. A cancelled
+// caller gives its turn back, so it doesn't hold up everyone after it.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	turn := l.reserve()
+	delay := time.Until(turn)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.release(turn)
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reserve claims the earliest free turn.
+func (l *RateLimiter) reserve() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for len(l.freed) > 0 && l.freed[0].Before(now) {
+		l.freed = l.freed[1:]
+	}
+	if len(l.freed) > 0 {
+		turn := l.freed[0]
+		l.freed = l.freed[1:]
+		return turn
+	}
+
+	turn := l.next
+	if turn.Before(now) {
+		turn = now
+	}
+	l.next = turn.Add(l.interval)
+	return turn
+}
+
+// release gives back a turn that won't be used. The last turn in the queue
+// shortens it; any other is kept for the next caller.
+func (l *RateLimiter) release(turn time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !turn.Add(l.interval).Equal(l.next) {
+		i, _ := slices.BinarySearchFunc(l.freed, turn, func(a time.Time, b time.Time) int { return a.Compare(b) })
+		l.freed = slices.Insert(l.freed, i, turn)
+		return
+	}
+	l.next = turn
+	for n := len(l.freed); n > 0 && l.freed[n-1].Add(l.interval).Equal(l.next); n-- {
+		l.next = l.freed[n-1]
+		l.freed = l.freed[:n-1]
+	}
+}
+
+// RateLimitedGenerator holds calls back to stay under the provider's limit,
+// however many requests or batch workers share it.
+type RateLimitedGenerator struct {
+	Generator
+	limiter *RateLimiter
+}
+
+func (g *RateLimitedGenerator) Generate(ctx context.Context, prompt Prompt) (LLMResponse, error) {
+	if err := g.limiter.Wait(ctx); err != nil {
+		return LLMResponse{}, err
+	}
+	return g.Generator.Generate(ctx, prompt)
+}
+
+func (g *RateLimitedGenerator) GenerateStream(ctx context.Context, prompt Prompt, onText func(text string)) (LLMResponse, error) {
+	if err := g.limiter.Wait(ctx); err != nil {
+		return LLMResponse{}, err
+	}
+	return generate(ctx, g.Generator, prompt, onText)
+}
+
+// takeTurn waits out generator's rate limit, if it has one, and returns the
+// generator to call now that the turn is taken. It lets a caller tell an
+// issue that is only queued from one being written.
+func takeTurn(ctx context.Context, generator Generator) (Generator, error) {
+	limited, ok := generator.(*RateLimitedGenerator)
+	if !ok {
+		return generator, nil
+	}
+	if err := limited.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return limited.Generator, nil
+}
+
+// entrySchema is the JSON schema of LLMResponse as the model should answer.
+var entrySchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"heading":     map[string]any{"type": "string"},
+		"description": map[string]any{"type": "string"},
+		"links": map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "string"},
+		},
+	},
+	"required":             []string{"heading", "description", "links"},
+	"additionalProperties": false,
+}
+
+// parseModelOutput reads the model's JSON answer. Local models sometimes wrap
+// it in a Markdown code fence even when asked for JSON, so that is dropped.
+func parseModelOutput(text string) (LLMResponse, error) {
+	var result LLMResponse
+
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```json")
+		text = strings.TrimPrefix(text, "```")
+		text = strings.TrimSuffix(text, "```")
+	}
+
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
+		return result, fmt.Errorf("parse model output: %w", err)
+	}
+	if result.Links == nil {
+		result.Links = []string{}
+	}
+	return result, nil
+}
+
+// FakeGenerator answers without calling a model, always the same way for the
+// same issue. It is meant for development and tests.
+type FakeGenerator struct{}
+
+func (FakeGenerator) Generate(ctx context.Context, prompt Prompt) (LLMResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return LLMResponse{}, err
+	}
+
+	content := prompt.Content
+	result := LLMResponse{
+		Heading:     "Completed Work on " + content.Heading,
+		Description: fmt.Sprintf("Work on %s had been carried out and completed.", content.Key),
+		Links:       []string{},
+	}
+	if content.Url != "" {
+		result.Links = append(result.Links, content.Url)
+	}
+	return result, nil
+}
+
+// GenerateStream hands over the answer's JSON a word at a time, the way a
+// streaming model would.
+func (g FakeGenerator) GenerateStream(ctx context.Context, prompt Prompt, onText func(text string)) (LLMResponse, error) {
+	result, err := g.Generate(ctx, prompt)
+	if err != nil {
+		return result, err
+	}
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return result, err
+	}
+	for _, word := range strings.SplitAfter(string(raw), " ") {
+		onText(word)
+	}
+	return result, nil
+}
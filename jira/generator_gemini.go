@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"google.golang.org/genai"
+	"net/http"
+	"strings"
+)
+
+const defaultGeminiModel = "gemini-2.0-flash"
+
+// GeminiGenerator calls Google's Gemini API.
+type GeminiGenerator struct {
+	client *genai.Client
+	model  string
+}
+
+func NewGeminiGenerator(ctx context.Context, config LLMConfig) (*GeminiGenerator, error) {
+	clientConfig := &genai.ClientConfig{
+		APIKey:     config.ApiKey,
+		Backend:    genai.BackendGeminiAPI,
+		HTTPClient: &http.Client{Timeout: generationTimeout},
+	}
+	if config.Endpoint != "" {
+		clientConfig.HTTPOptions.BaseURL = config.Endpoint
+	}
+
+	client, err := genai.NewClient(ctx, clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	model := config.Model
+	if model == "" {
+		model = defaultGeminiModel
+	}
+	return &GeminiGenerator{client: client, model: model}, nil
+}
+
+// entryConfig asks for JSON in the shape of LLMResponse.
+func (g *GeminiGenerator) entryConfig() *genai.GenerateContentConfig {
+	return &genai.GenerateContentConfig{
+		ResponseMIMEType: "application/json",
+		ResponseSchema: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"heading":     {Type: genai.TypeString},
+				"description": {Type: genai.TypeString},
+				"links": {
+					Type:  genai.TypeArray,
+					Items: &genai.Schema{Type: genai.TypeString},
+				},
+			},
+			PropertyOrdering: []string{"heading", "description", "links"},
+		},
+	}
+}
+
+func (g *GeminiGenerator) Generate(ctx context.Context, prompt Prompt) (LLMResponse, error) {
+	rawText, err := g.client.Models.GenerateContent(
+		ctx,
+		g.model,
+		genai.Text(prompt.Text),
+		g.entryConfig(),
+	)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	return parseModelOutput(rawText.Text())
+}
+
+func (g *GeminiGenerator) GenerateStream(ctx context.Context, prompt Prompt, onText func(text string)) (LLMResponse, error) {
+	var text strings.Builder
+	chunks := g.client.Models.GenerateContentStream(ctx, g.model, genai.Text(prompt.Text), g.entryConfig())
+	for chunk, err := range chunks {
+		if err != nil {
+			return LLMResponse{}, err
+		}
+		if part := chunk.Text(); part != "" {
+			text.WriteString(part)
+			onText(part)
+		}
+	}
+	return parseModelOutput(text.String())
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const defaultOpenAIEndpoint = "https://api.openai.com/v1"
+
+// OpenAIGenerator calls a chat completions API. Besides OpenAI itself that
+// covers local servers such as Ollama (http://localhost:11434/v1) and
+// llama.cpp, so ticket text never has to leave the network.
+type OpenAIGenerator struct {
+	endpoint string
+	model    string
+	apiKey   string
+	client   *http.Client
+}
+
+func NewOpenAIGenerator(config LLMConfig) (*OpenAIGenerator, error) {
+	if config.Model == "" {
+		return nil, errors.New("openai provider requires a model")
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = defaultOpenAIEndpoint
+	}
+	return &OpenAIGenerator{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		model:    config.Model,
+		apiKey:   config.ApiKey,
+		client:   &http.Client{Timeout: generationTimeout},
+	}, nil
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatJSONSchema struct {
+	Name   string         `json:"name"`
+	Schema map[string]any `json:"schema"`
+	Strict bool           `json:"strict"`
+}
+
+type chatResponseFormat struct {
+	Type       string          `json:"type"`
+	JSONSchema *chatJSONSchema `json:"json_schema,omitempty"`
+}
+
+type chatRequest struct {
+	Model          string             `json:"model"`
+	Messages       []chatMessage      `json:"messages"`
+	ResponseFormat chatResponseFormat `json:"response_format"`
+	Stream         bool               `json:"stream,omitempty"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// chatChunk is one streamed piece of a completion.
+type chatChunk struct {
+	Choices []struct {
+		Delta chatMessage `json:"delta"`
+	} `json:"choices"`
+}
+
+// complete posts the prompt to the chat completions endpoint and checks the
+// response status. The caller closes the body.
+func (g *OpenAIGenerator) complete(ctx context.Context, prompt Prompt, stream bool) (*http.Response, error) {
+	body, err := json.Marshal(chatRequest{
+		Model:    g.model,
+		Messages: []chatMessage{{Role: "user", Content: prompt.Text}},
+		ResponseFormat: chatResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &chatJSONSchema{Name: "entry", Schema: entrySchema, Strict: true},
+		},
+		Stream: stream,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.endpoint+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+g.apiKey)
+	}
+
+	res, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		detail, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return nil, fmt.Errorf("chat completions returned %s: %s", res.Status, strings.TrimSpace(string(detail)))
+	}
+	return res, nil
+}
+
+func (g *OpenAIGenerator) Generate(ctx context.Context, prompt Prompt) (LLMResponse, error) {
+	res, err := g.complete(ctx, prompt, false)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	defer res.Body.Close()
+
+	var completion chatResponse
+	if err := json.NewDecoder(res.Body).Decode(&completion); err != nil {
+		return LLMResponse{}, fmt.Errorf("decode chat completion: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return LLMResponse{}, errors.New("chat completion has no choices")
+	}
+	return parseModelOutput(completion.Choices[0].Message.Content)
+}
+
+// GenerateStream reads the completion as server-sent events, each carrying
+// the next piece of the answer, until the [DONE] marker.
+func (g *OpenAIGenerator) GenerateStream(ctx context.Context, prompt Prompt, onText func(text string)) (LLMResponse, error) {
+	res, err := g.complete(ctx, prompt, true)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	defer res.Body.Close()
+
+	var text strings.Builder
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk chatChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return LLMResponse{}, fmt.Errorf("decode chat chunk: %w", err)
+		}
+		for _, choice := range chunk.Choices {
+			if part := choice.Delta.Content; part != "" {
+				text.WriteString(part)
+				onText(part)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return LLMResponse{}, fmt.Errorf("read chat stream: %w", err)
+	}
+	return parseModelOutput(text.String())
+}
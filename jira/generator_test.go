@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterSpacesTurns(t *testing.T) {
+	limiter := &RateLimiter{interval: time.Hour}
+	first := limiter.reserve()
+	second := limiter.reserve()
+	if !second.Equal(first.Add(time.Hour)) {
+		t.Errorf("second turn is %v after the first, want an hour", second.Sub(first))
+	}
+}
+
+func TestRateLimiterCancelGivesTurnBack(t *testing.T) {
+	limiter := &RateLimiter{interval: time.Hour}
+	if err := limiter.Wait(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	next := limiter.next
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	for range 3 {
+		if err := limiter.Wait(ctx); !errors.Is(err, context.Canceled) {
+			t.Fatalf("Wait() = %v, want context.Canceled", err)
+		}
+	}
+	if !limiter.next.Equal(next) || len(limiter.freed) != 0 {
+		t.Errorf("cancelled callers moved the queue by %v", limiter.next.Sub(next))
+	}
+}
+
+func TestRateLimiterReleaseOutOfOrder(t *testing.T) {
+	limiter := &RateLimiter{interval: time.Hour}
+	now := limiter.reserve()
+	a := limiter.reserve()
+	b := limiter.reserve()
+	c := limiter.reserve()
+
+	// b's turn is kept for the next caller rather than lost.
+	limiter.release(b)
+	if turn := limiter.reserve(); !turn.Equal(b) {
+		t.Fatalf("next caller got %v, want b's turn", turn.Sub(now))
+	}
+	limiter.release(b)
+
+	// Once c goes too, the queue shrinks back past both.
+	limiter.release(a)
+	limiter.release(c)
+	if !limiter.next.Equal(a) || len(limiter.freed) != 0 {
+		t.Errorf("next turn is %v after now with %d freed, want a's turn with none", limiter.next.Sub(now), len(limiter.freed))
+	}
+}
+
+func TestTakeTurn(t *testing.T) {
+	if turn, err := takeTurn(t.Context(), FakeGenerator{}); err != nil || turn != (FakeGenerator{}) {
+		t.Errorf("takeTurn() = %v, %v, want the unlimited generator itself", turn, err)
+	}
+
+	limited := &RateLimitedGenerator{Generator: FakeGenerator{}, limiter: &RateLimiter{interval: time.Hour}}
+	turn, err := takeTurn(t.Context(), limited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := turn.(FakeGenerator); !ok {
+		t.Errorf("takeTurn() = %T, want the generator behind the limit", turn)
+	}
+
+	// The next turn is an hour away, so a caller that gives up never gets one.
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := takeTurn(ctx, limited); !errors.Is(err, context.Canceled) {
+		t.Errorf("takeTurn() = %v, want context.Canceled", err)
+	}
+}
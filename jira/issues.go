@@ -0,0 +1,342 @@
+package main
+
+import (
+	"JiraConnect/shared"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	issueDateLayout = "2006-01-02"
+	searchPageSize  = 100
+	searchPageLimit = 50
+)
+
+var issueScopes = shared.NewScopes(shared.ScopeReadIssueDetails, shared.ScopeReadField)
+
+// activityScopes are needed to read the changelog the monthly list is built
+// from.
+var activityScopes = shared.NewScopes(append(issueScopes, shared.ScopeReadIssueChangelog)...)
+
+var issueSearchFields = []string{"issuetype", "summary", "description", "status", "project", "assignee", "created", "updated"}
+
+type IssueType struct {
+	Name    string `json:"name"`
+	IconUrl string `json:"iconUrl"`
+}
+
+type JiraAccount struct {
+	AccountId   string `json:"accountId"`
+	DisplayName string `json:"displayName"`
+}
+
+type Issue struct {
+	Key         string         `json:"key"`
+	Summary     string         `json:"summary"`
+	Description string         `json:"description"`
+	Markdown    string         `json:"markdown"`
+	IssueType   IssueType      `json:"issueType"`
+	Status      string         `json:"status"`
+	Project     string         `json:"project"`
+	Created     string         `json:"created"`
+	Updated     string         `json:"updated"`
+	Url         string         `json:"url"`
+	Activity    *IssueActivity `json:"activity,omitempty"`
+}
+
+type IssueList struct {
+	Issues []Issue `json:"issues"`
+	Total  int     `json:"total"`
+}
+
+type IssueQuery struct {
+	Start    time.Time
+	End      time.Time
+	Projects []string
+	Statuses []string
+}
+
+type jiraStatus struct {
+	Id             string `json:"id"`
+	Name           string `json:"name"`
+	StatusCategory struct {
+		Key string `json:"key"`
+	} `json:"statusCategory"`
+}
+
+type jiraIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary     string          `json:"summary"`
+		Description json.RawMessage `json:"description"`
+		Created     string          `json:"created"`
+		Updated     string          `json:"updated"`
+		IssueType   IssueType       `json:"issuetype"`
+		Status      jiraStatus      `json:"status"`
+		Assignee    *JiraAccount    `json:"assignee"`
+		Project     struct {
+			Key string `json:"key"`
+		} `json:"project"`
+	} `json:"fields"`
+	RenderedFields struct {
+		Description string `json:"description"`
+	} `json:"renderedFields"`
+	Changelog jiraChangelog `json:"changelog"`
+}
+
+type searchResponse struct {
+	Issues        []jiraIssue `json:"issues"`
+	NextPageToken string      `json:"nextPageToken"`
+	IsLast        bool        `json:"isLast"`
+}
+
+func (i jiraIssue) normalise(site shared.Site) Issue {
+	return Issue{
+		Key:         i.Key,
+		Summary:     i.Fields.Summary,
+		Description: i.RenderedFields.Description,
+		Markdown:    adfToMarkdown(i.Fields.Description),
+		IssueType:   i.Fields.IssueType,
+		Status:      i.Fields.Status.Name,
+		Project:     i.Fields.Project.Key,
+		Created:     i.Fields.Created,
+		Updated:     i.Fields.Updated,
+		Url:         site.Url + "/browse/" + i.Key,
+	}
+}
+
+// JQL finds candidates for the period: issues assigned to the user at some
+// point in it, or that they updated in it. It deliberately over-matches;
+// buildActivity decides which ones were actually worked on.
+func (q IssueQuery) JQL() string {
+	start := quoteJQL(q.Start.Format(issueDateLayout))
+	end := quoteJQL(q.End.AddDate(0, 0, 1).Format(issueDateLayout))
+	clauses := []string{
+		fmt.Sprintf("(assignee WAS currentUser() DURING (%s, %s) OR issuekey IN updatedBy(currentUser(), %s, %s))", start, end, start, end),
+		fmt.Sprintf("created < %s", end),
+	}
+	if len(q.Projects) > 0 {
+		clauses = append(clauses, fmt.Sprintf("project in (%s)", quoteJQLList(q.Projects)))
+	}
+	if len(q.Statuses) > 0 {
+		clauses = append(clauses, fmt.Sprintf("status in (%s)", quoteJQLList(q.Statuses)))
+	}
+	return strings.Join(clauses, " AND ") + " ORDER BY updated DESC"
+}
+
+func quoteJQL(value string) string {
+	return strconv.Quote(value)
+}
+
+func quoteJQLList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = quoteJQL(v)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func splitParam(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				result = append(result, part)
+			}
+		}
+	}
+	return result
+}
+
+func parseIssueQuery(r *http.Request, loc *time.Location) (IssueQuery, error) {
+	params := r.URL.Query()
+	query := IssueQuery{
+		Projects: splitParam(params["project"]),
+		Statuses: splitParam(params["status"]),
+	}
+
+	period, err := parsePeriod(params.Get("start"), params.Get("end"), loc)
+	if err != nil {
+		return query, err
+	}
+	query.Start, query.End = period.Start, period.End
+	return query, nil
+}
+
+// Period is an inclusive range of whole days, such as a reporting month. Its
+// bounds are midnight in the user's time zone, so a day is the user's day.
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// userLocation is the user's Jira time zone, falling back to UTC when the
+// account doesn't report one or it isn't known.
+func userLocation(user shared.User) *time.Location {
+	if user.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(user.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func parsePeriod(start string, end string, loc *time.Location) (Period, error) {
+	var period Period
+	if start == "" || end == "" {
+		return period, errors.New("start and end are required (YYYY-MM-DD)")
+	}
+
+	var err error
+	if period.Start, err = time.ParseInLocation(issueDateLayout, start, loc); err != nil {
+		return period, fmt.Errorf("invalid start date %q", start)
+	}
+	if period.End, err = time.ParseInLocation(issueDateLayout, end, loc); err != nil {
+		return period, fmt.Errorf("invalid end date %q", end)
+	}
+	if period.End.Before(period.Start) {
+		return period, errors.New("end date is before start date")
+	}
+	return period, nil
+}
+
+// Contains reports whether t falls on any day of the period.
+func (p Period) Contains(t time.Time) bool {
+	return !t.Before(p.Start) && t.Before(p.End.AddDate(0, 0, 1))
+}
+
+func (c *JiraClient) SearchIssues(ctx context.Context, jql string, fields []string, expand ...string) ([]jiraIssue, error) {
+	var issues []jiraIssue
+	nextPageToken := ""
+
+	for page := 0; page < searchPageLimit; page++ {
+		query := url.Values{}
+		query.Set("jql", jql)
+		query.Set("fields", strings.Join(fields, ","))
+		query.Set("expand", strings.Join(append([]string{"renderedFields"}, expand...), ","))
+		query.Set("maxResults", strconv.Itoa(searchPageSize))
+		if nextPageToken != "" {
+			query.Set("nextPageToken", nextPageToken)
+		}
+
+		var res searchResponse
+		if err := c.Get(ctx, "/rest/api/3/search/jql", query, &res); err != nil {
+			return nil, err
+		}
+		issues = append(issues, res.Issues...)
+
+		if res.IsLast || res.NextPageToken == "" {
+			return issues, nil
+		}
+		nextPageToken = res.NextPageToken
+	}
+
+	return issues, fmt.Errorf("search exceeded %d pages", searchPageLimit)
+}
+
+var issueKeyPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*-[0-9]+$`)
+
+func (c *JiraClient) GetIssue(ctx context.Context, key string, fields []string) (jiraIssue, error) {
+	var issue jiraIssue
+	if !issueKeyPattern.MatchString(key) {
+		return issue, fmt.Errorf("invalid issue key %q", key)
+	}
+
+	query := url.Values{}
+	query.Set("fields", strings.Join(fields, ","))
+	err := c.Get(ctx, "/rest/api/3/issue/"+key, query, &issue)
+	return issue, err
+}
+
+// MonthlyIssues returns the issues accountId actually worked on during the
+// query's period, each with the activity that puts it there.
+func (c *JiraClient) MonthlyIssues(ctx context.Context, log *log.Logger, site shared.Site, accountId string, query IssueQuery) ([]Issue, error) {
+	found, err := c.SearchIssues(ctx, query.JQL(), issueSearchFields, "changelog")
+	if err != nil {
+		return nil, err
+	}
+
+	period := Period{Start: query.Start, End: query.End}
+	categories := statusCategories(ctx, log, c, found)
+
+	issues := make([]Issue, 0, len(found))
+	for _, issue := range found {
+		if err := c.completeChangelog(ctx, &issue); err != nil {
+			log.Printf("changelog for %s is incomplete: %v\n", issue.Key, err)
+		}
+		activity := buildActivity(issue, accountId, period, categories)
+		if !activity.Qualifies() {
+			continue
+		}
+
+		normalised := issue.normalise(site)
+		normalised.Activity = &activity
+		issues = append(issues, normalised)
+	}
+	return issues, nil
+}
+
+func handleSearchIssues(log *log.Logger, config shared.JiraConfig, httpClient *http.Client, sessions *shared.Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := shared.UserFromContext(r.Context())
+		query, err := parseIssueQuery(r, userLocation(user))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		client, site, err := siteClient(r, config, httpClient, sessions)
+		if err != nil {
+			http.Error(w, "Unable to resolve Jira site", http.StatusBadGateway)
+			log.Println("site resolution error:", err)
+			return
+		}
+
+		issues, err := client.MonthlyIssues(r.Context(), log, site, user.AccountId, query)
+		if err != nil {
+			var jiraErr *JiraError
+			if errors.As(err, &jiraErr) && jiraErr.StatusCode == http.StatusUnauthorized {
+				http.Error(w, "Not authorised", http.StatusUnauthorized)
+			} else {
+				http.Error(w, "Error retrieving issues", http.StatusBadGateway)
+			}
+			log.Println("issue search error:", err)
+			return
+		}
+
+		list := IssueList{Issues: issues, Total: len(issues)}
+
+		if err := shared.Encode(w, http.StatusOK, list); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
+
+// statusCategories prefers the site's full status list, but falls back to the
+// statuses the issues are in now when that can't be read.
+func statusCategories(ctx context.Context, log *log.Logger, client *JiraClient, issues []jiraIssue) map[string]string {
+	categories, err := client.GetStatusCategories(ctx)
+	if err != nil {
+		log.Println("status categories error:", err)
+		categories = make(map[string]string)
+	}
+	for _, issue := range issues {
+		status := issue.Fields.Status
+		if _, ok := categories[status.Id]; !ok {
+			categories[status.Id] = status.StatusCategory.Key
+		}
+	}
+	return categories
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssueQueryJQL(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+	period := `(assignee WAS currentUser() DURING ("2025-01-01", "2025-02-01") OR issuekey IN updatedBy(currentUser(), "2025-01-01", "2025-02-01")) AND created < "2025-02-01"`
+
+	tests := []struct {
+		name  string
+		query IssueQuery
+		want  string
+	}{
+		{
+			name:  "period only",
+			query: IssueQuery{Start: start, End: end},
+			want:  period + " ORDER BY updated DESC",
+		},
+		{
+			name:  "projects",
+			query: IssueQuery{Start: start, End: end, Projects: []string{"ABC", "DEF"}},
+			want:  period + ` AND project in ("ABC", "DEF") ORDER BY updated DESC`,
+		},
+		{
+			name:  "statuses",
+			query: IssueQuery{Start: start, End: end, Statuses: []string{"In Progress"}},
+			want:  period + ` AND status in ("In Progress") ORDER BY updated DESC`,
+		},
+		{
+			name:  "quotes are escaped",
+			query: IssueQuery{Start: start, End: end, Projects: []string{`A") OR ("B`}},
+			want:  period + ` AND project in ("A\") OR (\"B") ORDER BY updated DESC`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.query.JQL(); got != tt.want {
+				t.Errorf("JQL() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		start   string
+		end     string
+		loc     *time.Location
+		want    Period
+		wantErr bool
+	}{
+		{
+			name:  "month",
+			start: "2025-01-01",
+			end:   "2025-01-31",
+			want: Period{
+				Start: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+				End:   time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:  "single day",
+			start: "2025-01-15",
+			end:   "2025-01-15",
+			want: Period{
+				Start: time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC),
+				End:   time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:  "user's time zone",
+			start: "2025-01-01",
+			end:   "2025-01-31",
+			loc:   berlin,
+			want: Period{
+				Start: time.Date(2024, 12, 31, 23, 0, 0, 0, time.UTC),
+				End:   time.Date(2025, 1, 30, 23, 0, 0, 0, time.UTC),
+			},
+		},
+		{name: "missing start", end: "2025-01-31", wantErr: true},
+		{name: "missing end", start: "2025-01-01", wantErr: true},
+		{name: "bad start", start: "01/01/2025", end: "2025-01-31", wantErr: true},
+		{name: "bad end", start: "2025-01-01", end: "2025-13-01", wantErr: true},
+		{name: "end before start", start: "2025-02-01", end: "2025-01-31", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := tt.loc
+			if loc == nil {
+				loc = time.UTC
+			}
+			got, err := parsePeriod(tt.start, tt.end, loc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePeriod() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (!got.Start.Equal(tt.want.Start) || !got.End.Equal(tt.want.End)) {
+				t.Errorf("parsePeriod() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIssueQueryFilters(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		wantProjects []string
+		wantStatuses []string
+		wantErr      bool
+	}{
+		{
+			name:  "no filters",
+			query: "start=2025-01-01&end=2025-01-31",
+		},
+		{
+			name:         "comma separated",
+			query:        "start=2025-01-01&end=2025-01-31&project=ABC,DEF&status=Done",
+			wantProjects: []string{"ABC", "DEF"},
+			wantStatuses: []string{"Done"},
+		},
+		{
+			name:         "repeated and padded",
+			query:        "start=2025-01-01&end=2025-01-31&project=ABC&project=+DEF+,,&status=In+Progress",
+			wantProjects: []string{"ABC", "DEF"},
+			wantStatuses: []string{"In Progress"},
+		},
+		{
+			name:    "period is required",
+			query:   "project=ABC",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/issues?"+tt.query, nil)
+			got, err := parseIssueQuery(r, time.UTC)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseIssueQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got.Projects, tt.wantProjects) {
+				t.Errorf("Projects = %q, want %q", got.Projects, tt.wantProjects)
+			}
+			if !reflect.DeepEqual(got.Statuses, tt.wantStatuses) {
+				t.Errorf("Statuses = %q, want %q", got.Statuses, tt.wantStatuses)
+			}
+		})
+	}
+}
+
+// searchServer answers /search/jql with one issue per page, handing out a
+// next page token until pages have been served. A pages of zero never ends.
+func searchServer(t *testing.T, pages int) (*httptest.Server, *[]string) {
+	t.Helper()
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/3/search/jql" {
+			http.NotFound(w, r)
+			return
+		}
+		token := r.URL.Query().Get("nextPageToken")
+		tokens = append(tokens, token)
+
+		page := len(tokens)
+		res := map[string]any{
+			"issues": []map[string]any{{"key": fmt.Sprintf("ABC-%d", page)}},
+		}
+		if pages == 0 || page < pages {
+			res["nextPageToken"] = fmt.Sprintf("page-%d", page+1)
+		} else {
+			res["isLast"] = true
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(server.Close)
+	return server, &tokens
+}
+
+func TestSearchIssuesPaginates(t *testing.T) {
+	server, tokens := searchServer(t, 3)
+	client := NewJiraClient(server.Client(), server.URL, "Bearer token")
+
+	issues, err := client.SearchIssues(t.Context(), "project = ABC", []string{"summary"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{}
+	for _, issue := range issues {
+		keys = append(keys, issue.Key)
+	}
+	if want := []string{"ABC-1", "ABC-2", "ABC-3"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %q, want %q", keys, want)
+	}
+	if want := []string{"", "page-2", "page-3"}; !reflect.DeepEqual(*tokens, want) {
+		t.Errorf("tokens sent = %q, want %q", *tokens, want)
+	}
+}
+
+func TestSearchIssuesPageLimit(t *testing.T) {
+	server, tokens := searchServer(t, 0)
+	client := NewJiraClient(server.Client(), server.URL, "Bearer token")
+
+	issues, err := client.SearchIssues(t.Context(), "project = ABC", []string{"summary"})
+	if err == nil || !strings.Contains(err.Error(), "exceeded") {
+		t.Fatalf("err = %v, want page limit error", err)
+	}
+	if len(*tokens) != searchPageLimit {
+		t.Errorf("requests = %d, want %d", len(*tokens), searchPageLimit)
+	}
+	if len(issues) != searchPageLimit {
+		t.Errorf("issues = %d, want the %d fetched before the limit", len(issues), searchPageLimit)
+	}
+}
+
+func TestSearchIssuesJiraError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"errorMessages":["bad jql"]}`))
+	}))
+	defer server.Close()
+	client := NewJiraClient(server.Client(), server.URL, "Bearer token")
+
+	_, err := client.SearchIssues(t.Context(), "nonsense", nil)
+	jiraErr, ok := err.(*JiraError)
+	if !ok {
+		t.Fatalf("err = %v, want *JiraError", err)
+	}
+	if jiraErr.StatusCode != http.StatusBadRequest || !reflect.DeepEqual(jiraErr.Messages, []string{"bad jql"}) {
+		t.Errorf("err = %+v", jiraErr)
+	}
+}
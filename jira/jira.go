@@ -2,129 +2,143 @@ package main
 
 import (
 	"JiraConnect/shared"
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
 )
 
-func handleGenerateToken(log *log.Logger, config shared.JiraConfig) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		code := r.Header.Get("X-Code")
-		if code == "" {
-			http.Error(w, "Missing X-Code", http.StatusBadRequest)
-		}
-		values := map[string]string{
-			"grant_type":    "authorization_code",
-			"code":          code,
-			"client_id":     config.Cid,
-			"client_secret": config.Secret,
-			"redirect_uri":  config.RedirectUrl,
-		}
-
-		jsonValue, _ := json.Marshal(values)
-		oauth, err := http.Post(
-			config.OauthUrl,
-			"application/json",
-			bytes.NewBuffer(jsonValue),
-		)
-
-		if oauth != nil {
-			if oauth.StatusCode != http.StatusOK {
-				body, _ := io.ReadAll(oauth.Body)
-				http.Error(w, "Error Authenticating", http.StatusBadRequest)
-				log.Println(string(body))
-				return
-			}
+type grantRejection struct {
+	status  int
+	message string
+}
 
-			res := shared.Oauth{}
-			err := json.NewDecoder(oauth.Body).Decode(&res)
-			if err != nil {
-				http.Error(w, "Error Authenticating", http.StatusBadRequest)
-				log.Println("oauth error:", err)
-				return
-			}
+func (e *grantRejection) Error() string {
+	return e.message
+}
 
-			if res.AccessToken == "" {
-				http.Error(w, "Error Authenticating", http.StatusBadRequest)
-				log.Println("Error retrieving oauth - JSON is empty")
-			}
-
-			shared.SetJiraCookie(w, log, res)
-		}
+type grantFunc func(w http.ResponseWriter, r *http.Request) (shared.Session, error)
 
+// handleGrant runs either OAuth grant against the caller's session, so both
+// /oauth and /refresh share the same error handling and response.
+func handleGrant(log *log.Logger, grant grantFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := grant(w, r)
 		if err != nil {
-			http.Error(w, "Error retrieving authentication", http.StatusInternalServerError)
-			log.Println("Error retrieving oauth:", err)
+			writeGrantError(w, log, err)
 			return
 		}
 
-		defer oauth.Body.Close()
+		if err := shared.Encode(w, http.StatusOK, session.Info()); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
 	}
 }
 
-func handleRefreshToken(log *log.Logger, config shared.JiraConfig) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		var token string
-		if token = r.Header.Get("x-refresh"); token == "" {
-			http.Error(w, "Unauthorised", http.StatusUnauthorized)
+func writeGrantError(w http.ResponseWriter, log *log.Logger, err error) {
+	var rejection *grantRejection
+	var oauthErr *shared.OauthError
+
+	switch {
+	case errors.As(err, &rejection):
+		http.Error(w, rejection.message, rejection.status)
+	case errors.Is(err, shared.ErrNoSession):
+		http.Error(w, "Not authorised", http.StatusUnauthorized)
+	case errors.As(err, &oauthErr), errors.Is(err, shared.ErrEmptyToken):
+		http.Error(w, "Error Authenticating", http.StatusBadRequest)
+	default:
+		http.Error(w, "Error retrieving authentication", http.StatusBadGateway)
+	}
+	log.Println("oauth grant error:", err)
+}
+
+func handleGenerateToken(log *log.Logger, config shared.JiraConfig, tokens shared.TokenGranter, sessions *shared.Sessions, httpClient *http.Client, ledger *shared.StateLedger) http.HandlerFunc {
+	return handleGrant(log, func(w http.ResponseWriter, r *http.Request) (shared.Session, error) {
+		code := r.Header.Get("X-Code")
+		if code == "" {
+			return shared.Session{}, &grantRejection{http.StatusBadRequest, "Missing X-Code"}
 		}
 
-		values := map[string]string{
-			"grant_type":    "refresh_token",
-			"refresh_token": token,
-			"client_id":     config.Cid,
-			"client_secret": config.Secret,
+		state, err := shared.ReadStateCookie(r, config.StateSecret, r.Header.Get("X-State"))
+		if err == nil && config.Pkce && state.Verifier == "" {
+			err = shared.ErrPkceMissing
+		}
+		if err == nil {
+			err = ledger.Consume(state)
+		}
+		shared.ClearStateCookie(w)
+		if err != nil {
+			return shared.Session{}, &grantRejection{http.StatusForbidden, "Login could not be verified: " + err.Error()}
 		}
 
-		jsonValue, _ := json.Marshal(values)
-		oauth, err := http.Post(
-			config.OauthUrl,
-			"application/json",
-			bytes.NewBuffer(jsonValue),
-		)
+		token, err := tokens.ExchangeCode(r.Context(), code, state.Verifier)
+		if err != nil {
+			return shared.Session{}, err
+		}
 
-		defer func(Body io.ReadCloser) {
-			err := Body.Close()
-			if err != nil {
-				log.Println("Error closing body:", err)
-			}
-		}(oauth.Body)
-
-		if oauth != nil {
-			if oauth.StatusCode != http.StatusOK {
-				body, _ := io.ReadAll(oauth.Body)
-				http.Error(w, "Error Authenticating", http.StatusBadRequest)
-				log.Println(string(body))
-				return
-			}
+		session, err := sessions.Start(r.Context(), w, r, token)
+		if err != nil {
+			return shared.Session{}, err
+		}
 
-			res := shared.Oauth{}
-			err := json.NewDecoder(oauth.Body).Decode(&res)
+		// Atlassian lets the user untick scopes on the consent screen, which
+		// otherwise only shows up later as a silent 403.
+		if missing := shared.MissingScopes(token.Scope, config.Scopes); len(missing) > 0 {
+			log.Printf("login granted without scopes: %s\n", missing)
+			session, err = sessions.Update(r.Context(), session.Id, func(session *shared.Session) {
+				session.Missing = missing
+			})
 			if err != nil {
-				http.Error(w, "Error Authenticating", http.StatusBadRequest)
-				log.Println("failed to retrieve refresh: ", err)
-				return
+				return shared.Session{}, err
 			}
+		}
+		rememberSite(r.Context(), log, httpClient, sessions, &session)
+		return session, nil
+	})
+}
 
-			if res.AccessToken == "" {
-				http.Error(w, "Error Authenticating", http.StatusBadRequest)
-				log.Println("failed to retrieve refresh - JSON is empty")
-			}
+func handleRefreshToken(log *log.Logger, sessions *shared.Sessions) http.HandlerFunc {
+	return handleGrant(log, func(w http.ResponseWriter, r *http.Request) (shared.Session, error) {
+		session, err := sessions.Load(r.Context(), r)
+		if err != nil {
+			return shared.Session{}, err
+		}
 
-			shared.SetJiraCookie(w, log, res)
+		return sessions.Refresh(r.Context(), session)
+	})
+}
+
+func handleLogout(log *log.Logger, sessions *shared.Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		shared.ClearJiraCookies(w)
+		if err := sessions.Logout(r.Context(), w, r); err != nil {
+			log.Println("logout error:", err)
 		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
 
-		if err != nil {
-			http.Error(w, "Error retrieving authentication", http.StatusInternalServerError)
-			log.Println("Error retrieving oauth:", err)
-			return
+func handleSessionInfo(log *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := shared.SessionFromContext(r.Context())
+		if err := shared.Encode(w, http.StatusOK, session.Info()); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
 		}
 	}
+}
 
+func handleCurrentUser(log *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := shared.UserFromContext(r.Context())
+		if err := shared.Encode(w, http.StatusOK, user); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
 }
 
 func handleTempIssue(log *log.Logger) http.HandlerFunc {
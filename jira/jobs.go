@@ -0,0 +1,595 @@
+package main
+
+import (
+	"JiraConnect/shared"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A job moves from queued to running and ends in one of the other states.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+
+	// concurrentJobs is how many jobs run at once. Each already generates
+	// LLM_WORKERS issues at a time through the shared rate limit.
+	concurrentJobs = 2
+)
+
+var errJobFinished = errors.New("job has already finished")
+
+// JobProgress counts a job's issues. Completed includes the Failed ones.
+type JobProgress struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// JobResult is one issue's outcome. EntryId is set whenever the entry was
+// stored, including entries kept with their generation error.
+type JobResult struct {
+	Key     string `json:"key"`
+	EntryId string `json:"entryId,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Job is a monthly report generated in the background. Its report is created
+// as soon as it starts and fills up one entry at a time.
+type Job struct {
+	Id        string `json:"id"`
+	AccountId string `json:"accountId"`
+	// SessionId lets the job call Jira as the user after the request that
+	// queued it has ended. It is the cookie value, so it never leaves the
+	// server: see public.
+	SessionId  string      `json:"sessionId,omitempty"`
+	CloudId    string      `json:"cloudId"`
+	Month      string      `json:"month"`
+	Status     string      `json:"status"`
+	Progress   JobProgress `json:"progress"`
+	Results    []JobResult `json:"results"`
+	ReportId   string      `json:"reportId,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	UpdatedAt  time.Time   `json:"updatedAt"`
+	StartedAt  *time.Time  `json:"startedAt,omitempty"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+}
+
+func (j Job) finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// public is the job as the page sees it.
+func (j Job) public() Job {
+	j.SessionId = ""
+	return j
+}
+
+func (j *Job) record(result JobResult) {
+	j.Results = append(j.Results, result)
+	j.Progress.Completed++
+	if result.Error != "" {
+		j.Progress.Failed++
+	}
+}
+
+// resume rebuilds the job's results from the entries a previous run stored,
+// which are the record of what it got through. Entries that failed are
+// handed back to be deleted and generated again, along with the issues that
+// have no entry yet.
+func (j *Job) resume(issues []Issue, entries []Entry) (pending []Issue, failed []Entry) {
+	done := map[string]bool{}
+	j.Results = []JobResult{}
+	j.Progress = JobProgress{Total: len(issues)}
+	for _, entry := range entries {
+		if entry.Error != "" {
+			failed = append(failed, entry)
+			continue
+		}
+		done[entry.Key] = true
+		j.record(JobResult{Key: entry.Key, EntryId: entry.Id})
+	}
+
+	pending = []Issue{}
+	for _, issue := range issues {
+		if !done[issue.Key] {
+			pending = append(pending, issue)
+		}
+	}
+	return pending, failed
+}
+
+// sortJobs puts jobs in the order they were queued.
+func sortJobs(jobs []Job) {
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+}
+
+// jobErrorMessage is what the page is told about a failed job; the details
+// stay in the log.
+func jobErrorMessage(err error) string {
+	var jiraErr *JiraError
+	switch {
+	case errors.Is(err, shared.ErrNoSession):
+		return "session ended, sign in and start the job again"
+	case errors.Is(err, errNoSite):
+		return "Jira site is no longer accessible"
+	case errors.As(err, &jiraErr) && jiraErr.StatusCode == http.StatusUnauthorized:
+		return "not authorised"
+	case errors.As(err, &jiraErr):
+		return "error retrieving issues"
+	default:
+		return "error building report"
+	}
+}
+
+// jobSessionStore fills in SESSION_STORE when it is unset: a file whenever
+// jobs are kept in one, since a resumed job calls Jira through the session of
+// the user who queued it.
+func jobSessionStore(data StoreConfig, sessions shared.SessionConfig) shared.SessionConfig {
+	if sessions.Store == "" && data.Store != "memory" {
+		sessions.Store = "file"
+	}
+	return sessions
+}
+
+// validateJobStores reports a data store that keeps jobs across restarts
+// alongside a session store that doesn't. Jobs resumed after a restart then
+// fail, as their user's session is gone.
+func validateJobStores(data StoreConfig, sessions shared.SessionConfig) error {
+	if data.Store == "memory" || sessions.Store == "file" {
+		return nil
+	}
+	return errors.New("jobs resumed after a restart will fail without their sessions: set SESSION_STORE=file, or DATA_STORE=memory to drop jobs on restart")
+}
+
+// JobRunner works through queued jobs in the background. Jobs are stored as
+// they progress, so a restart carries on from the last finished issue.
+type JobRunner struct {
+	log        *log.Logger
+	store      Repository
+	sessions   *shared.Sessions
+	generator  Generator
+	jiraConfig shared.JiraConfig
+	httpClient *http.Client
+	workers    int
+
+	ctx   context.Context
+	queue chan string
+
+	// mu guards running and every status change, so a cancel can't race a
+	// job being picked up.
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+}
+
+func NewJobRunner(log *log.Logger, store Repository, sessions *shared.Sessions, generator Generator, jiraConfig shared.JiraConfig, workers int) *JobRunner {
+	return &JobRunner{
+		log:        log,
+		store:      store,
+		sessions:   sessions,
+		generator:  generator,
+		jiraConfig: jiraConfig,
+		httpClient: NewJiraHttpClient(),
+		workers:    workers,
+		queue:      make(chan string),
+		running:    make(map[string]context.CancelFunc),
+	}
+}
+
+// Start runs jobs until ctx ends and queues again every job a previous run
+// left unfinished. It must be called before anything is enqueued.
+func (jr *JobRunner) Start(ctx context.Context) error {
+	jr.ctx = ctx
+	for range concurrentJobs {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-jr.queue:
+					jr.run(id)
+				}
+			}
+		}()
+	}
+
+	jobs, err := jr.store.ListJobs(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if !job.finished() {
+			jr.log.Printf("resuming %s job %s\n", job.Status, job.Id)
+			jr.Enqueue(job.Id)
+		}
+	}
+	return nil
+}
+
+// Enqueue hands the job to the next free runner without waiting for one.
+func (jr *JobRunner) Enqueue(id string) {
+	go func() {
+		select {
+		case jr.queue <- id:
+		case <-jr.ctx.Done():
+		}
+	}()
+}
+
+// Cancel stops a job. A queued job is cancelled straight away; a running one
+// is told to stop and records its cancellation once its workers return, so
+// the job handed back may still be running.
+func (jr *JobRunner) Cancel(ctx context.Context, id string) (Job, error) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	job, err := jr.store.GetJob(ctx, id)
+	if err != nil {
+		return job, err
+	}
+	if cancel, ok := jr.running[id]; ok {
+		cancel()
+		return job, nil
+	}
+	if job.finished() {
+		return job, errJobFinished
+	}
+
+	now := time.Now().UTC()
+	job.Status = JobCancelled
+	job.FinishedAt = &now
+	job.UpdatedAt = now
+	return job, jr.store.SaveJob(ctx, job)
+}
+
+// claim marks a queued job as running, or reports false when it was
+// cancelled or picked up already.
+func (jr *JobRunner) claim(id string, cancel context.CancelFunc) (Job, bool) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	job, err := jr.store.GetJob(jr.ctx, id)
+	if err != nil {
+		jr.log.Printf("unable to load job %s: %v\n", id, err)
+		return job, false
+	}
+	if _, ok := jr.running[id]; ok || job.finished() {
+		return job, false
+	}
+
+	now := time.Now().UTC()
+	job.Status = JobRunning
+	if job.StartedAt == nil {
+		job.StartedAt = &now
+	}
+	job.UpdatedAt = now
+	if err := jr.store.SaveJob(jr.ctx, job); err != nil {
+		jr.log.Printf("unable to start job %s: %v\n", id, err)
+		return job, false
+	}
+	jr.running[id] = cancel
+	return job, true
+}
+
+func (jr *JobRunner) release(id string) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	delete(jr.running, id)
+}
+
+func (jr *JobRunner) save(job Job) {
+	job.UpdatedAt = time.Now().UTC()
+	if err := jr.store.SaveJob(jr.ctx, job); err != nil {
+		jr.log.Printf("unable to save job %s: %v\n", job.Id, err)
+	}
+}
+
+func (jr *JobRunner) run(id string) {
+	ctx, cancel := context.WithCancel(jr.ctx)
+	defer cancel()
+
+	job, ok := jr.claim(id, cancel)
+	if !ok {
+		return
+	}
+	defer jr.release(id)
+
+	err := jr.generate(ctx, &job)
+	switch {
+	case jr.ctx.Err() != nil:
+		// Shutting down: the job stays running so Start picks it up again.
+		jr.log.Printf("job %s interrupted: %v\n", id, jr.ctx.Err())
+		return
+	case ctx.Err() != nil:
+		job.Status = JobCancelled
+	case err != nil:
+		jr.log.Printf("job %s failed: %v\n", id, err)
+		job.Status = JobFailed
+		job.Error = jobErrorMessage(err)
+	default:
+		job.Status = JobSucceeded
+	}
+
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+	jr.save(job)
+}
+
+// generate builds the job's report, skipping issues a previous run already
+// stored an entry for and retrying those it failed. Each entry fetches the
+// session again, so its access token is refreshed however long the job runs.
+func (jr *JobRunner) generate(ctx context.Context, job *Job) error {
+	session, err := jr.sessions.Get(ctx, job.SessionId)
+	if err != nil {
+		return err
+	}
+	ctx = shared.WithSession(ctx, session)
+
+	stored, err := jr.store.GetUser(ctx, job.AccountId)
+	if err != nil {
+		return err
+	}
+	user := shared.User{AccountId: stored.AccountId, Name: stored.Name, Email: stored.Email, TimeZone: stored.TimeZone}
+
+	sites, err := listSites(ctx, jr.httpClient)
+	if err != nil {
+		return err
+	}
+	site, ok := shared.FindSite(sites, job.CloudId)
+	if !ok {
+		return errNoSite
+	}
+	client := NewJiraClient(jr.httpClient, jiraBaseUrl(jr.jiraConfig, site, session), session.Authorization())
+
+	period, err := monthPeriod(job.Month, userLocation(user))
+	if err != nil {
+		return err
+	}
+	issues, hours, totalHours, err := reportIssues(ctx, jr.log, client, site, job.AccountId, period)
+	if err != nil {
+		return err
+	}
+
+	if job.ReportId == "" {
+		report := newReport(site, user, period)
+		report.Totals.Hours = totalHours
+		if err := saveReport(ctx, jr.store, &report, user); err != nil {
+			return err
+		}
+		job.ReportId = report.Id
+	}
+
+	entries, err := jr.store.ListEntries(ctx, EntryFilter{ReportId: job.ReportId})
+	if err != nil {
+		return err
+	}
+	pending, failed := job.resume(issues, entries)
+	for _, entry := range failed {
+		if err := jr.store.DeleteEntry(ctx, entry.Id); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	jr.save(*job)
+
+	var mu sync.Mutex
+	filter := CommentFilter{AccountId: job.AccountId, Period: &period}
+	forEachConcurrently(len(pending), jr.workers, func(i int) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		issue := pending[i]
+		client, err := jr.client(ctx, job.SessionId, site)
+		if err != nil {
+			jr.log.Printf("job %s entry %s has no session: %v\n", job.Id, issue.Key, err)
+			mu.Lock()
+			defer mu.Unlock()
+			job.record(JobResult{Key: issue.Key, Error: jobErrorMessage(err)})
+			jr.save(*job)
+			return
+		}
+		entry := reportEntry(ctx, jr.log, jr.generator, client, job.AccountId, issue, hours[issue.Key], filter)
+		// An issue cut short is generated again on resume rather than kept
+		// as a failure.
+		if ctx.Err() != nil {
+			return
+		}
+
+		entry.ReportId = job.ReportId
+		result := JobResult{Key: issue.Key, Error: entry.Error}
+		if err := createEntry(ctx, jr.store, &entry, RevisionSourceModel, user); err != nil {
+			jr.log.Printf("job %s entry %s not stored: %v\n", job.Id, issue.Key, err)
+			result.Error = "unable to store entry"
+		} else {
+			result.EntryId = entry.Id
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		job.record(result)
+		jr.save(*job)
+	})
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return completeReport(ctx, jr.store, job.ReportId)
+}
+
+// client calls Jira as the job's user with the session as it is now, refreshed
+// if its access token is about to expire.
+func (jr *JobRunner) client(ctx context.Context, sessionId string, site shared.Site) (*JiraClient, error) {
+	session, err := jr.sessions.Get(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	return NewJiraClient(jr.httpClient, jiraBaseUrl(jr.jiraConfig, site, session), session.Authorization()), nil
+}
+
+// completeReport recounts a report generated entry by entry and takes its
+// prompt version from the first entry that has one.
+func completeReport(ctx context.Context, store Repository, reportId string) error {
+	report, err := store.GetReport(ctx, reportId)
+	if err != nil {
+		return err
+	}
+	report.Totals, report.Links = reportTotals(report.Entries, report.Totals.Hours)
+	for _, entry := range report.Entries {
+		if report.PromptVersion == "" {
+			report.PromptVersion = entry.PromptVersion
+		}
+	}
+	report.UpdatedAt = time.Now().UTC()
+	return store.SaveReport(ctx, report)
+}
+
+// ownedJob loads a job, answering ErrNotFound for someone else's so ids can't
+// be probed.
+func ownedJob(ctx context.Context, store Repository, id string, accountId string) (Job, error) {
+	job, err := store.GetJob(ctx, id)
+	if err != nil {
+		return job, err
+	}
+	if job.AccountId != accountId {
+		return Job{}, ErrNotFound
+	}
+	return job, nil
+}
+
+// handleCreateJob queues a month's report to be generated in the background
+// and answers straight away. The page polls GET /jobs/{id} for progress.
+func handleCreateJob(log *log.Logger, jobs *JobRunner, httpClient *http.Client, sessions *shared.Sessions, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload ReportRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid JSON payload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if _, err := monthPeriod(payload.Month, time.UTC); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		site, err := resolveSite(r.Context(), r, httpClient, sessions)
+		if err != nil {
+			http.Error(w, "Unable to resolve Jira site", http.StatusBadGateway)
+			log.Println("site resolution error:", err)
+			return
+		}
+
+		id, err := newRecordId()
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		session, _ := shared.SessionFromContext(r.Context())
+		user, _ := shared.UserFromContext(r.Context())
+		if err := rememberUser(r.Context(), store, user); err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		now := time.Now().UTC()
+		job := Job{
+			Id:        id,
+			AccountId: user.AccountId,
+			SessionId: session.Id,
+			CloudId:   site.Id,
+			Month:     payload.Month,
+			Status:    JobQueued,
+			Results:   []JobResult{},
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := store.SaveJob(r.Context(), job); err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+		jobs.Enqueue(job.Id)
+
+		w.Header().Set("Location", "/jobs/"+job.Id)
+		if err := shared.Encode(w, http.StatusAccepted, job.public()); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
+
+func handleListJobs(log *log.Logger, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := shared.UserFromContext(r.Context())
+		jobs, err := store.ListJobs(r.Context(), user.AccountId)
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+		for i := range jobs {
+			jobs[i] = jobs[i].public()
+		}
+
+		if err := shared.Encode(w, http.StatusOK, jobs); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
+
+func handleGetJob(log *log.Logger, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := shared.UserFromContext(r.Context())
+		job, err := ownedJob(r.Context(), store, r.PathValue("id"), user.AccountId)
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		if err := shared.Encode(w, http.StatusOK, job.public()); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
+
+// handleCancelJob answers 202 while a running job winds down and 200 once
+// the job is cancelled. Entries already generated are kept in its report.
+func handleCancelJob(log *log.Logger, jobs *JobRunner, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := shared.UserFromContext(r.Context())
+		job, err := ownedJob(r.Context(), store, r.PathValue("id"), user.AccountId)
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		job, err = jobs.Cancel(r.Context(), job.Id)
+		if errors.Is(err, errJobFinished) {
+			http.Error(w, "Job has already finished", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		status := http.StatusOK
+		if job.Status != JobCancelled {
+			status = http.StatusAccepted
+		}
+		if err := shared.Encode(w, status, job.public()); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"JiraConnect/shared"
+	"context"
+	"io"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJobSessionStore(t *testing.T) {
+	tests := []struct {
+		data     string
+		sessions string
+		want     string
+		wantErr  bool
+	}{
+		{data: "", sessions: "", want: "file"},
+		{data: "file", sessions: "", want: "file"},
+		{data: "memory", sessions: "", want: ""},
+		{data: "file", sessions: "memory", want: "memory", wantErr: true},
+		{data: "", sessions: "file", want: "file"},
+		{data: "memory", sessions: "file", want: "file"},
+	}
+	for _, tt := range tests {
+		data := StoreConfig{Store: tt.data}
+		sessions := jobSessionStore(data, shared.SessionConfig{Store: tt.sessions})
+		if sessions.Store != tt.want {
+			t.Errorf("DATA_STORE=%q SESSION_STORE=%q: session store = %q, want %q", tt.data, tt.sessions, sessions.Store, tt.want)
+		}
+		if err := validateJobStores(data, sessions); (err != nil) != tt.wantErr {
+			t.Errorf("DATA_STORE=%q SESSION_STORE=%q: error = %v, wantErr %v", tt.data, tt.sessions, err, tt.wantErr)
+		}
+	}
+}
+
+func TestJobResume(t *testing.T) {
+	issues := []Issue{{Key: "A-1"}, {Key: "A-2"}, {Key: "A-3"}}
+	entries := []Entry{
+		{Id: "e1", Key: "A-1"},
+		{Id: "e2", Key: "A-2", Error: "generation timed out"},
+	}
+
+	job := Job{Results: []JobResult{{Key: "stale"}}, Progress: JobProgress{Completed: 9}}
+	pending, failed := job.resume(issues, entries)
+
+	if want := []JobResult{{Key: "A-1", EntryId: "e1"}}; !reflect.DeepEqual(job.Results, want) {
+		t.Errorf("results = %+v, want %+v", job.Results, want)
+	}
+	if want := (JobProgress{Total: 3, Completed: 1}); job.Progress != want {
+		t.Errorf("progress = %+v, want %+v", job.Progress, want)
+	}
+	if want := []Issue{{Key: "A-2"}, {Key: "A-3"}}; !reflect.DeepEqual(pending, want) {
+		t.Errorf("pending = %+v, want the failed and missing issues", pending)
+	}
+	if len(failed) != 1 || failed[0].Id != "e2" {
+		t.Errorf("failed = %+v, want the errored entry", failed)
+	}
+}
+
+func TestJobRunnerStartResumesUnfinished(t *testing.T) {
+	store := NewMemoryRepository()
+	created := time.Date(2025, 2, 1, 9, 0, 0, 0, time.UTC)
+	for _, job := range []Job{
+		{Id: "queued", AccountId: "me", SessionId: "gone", Month: "2025-01", Status: JobQueued, CreatedAt: created},
+		{Id: "running", AccountId: "me", SessionId: "gone", Month: "2025-01", Status: JobRunning, CreatedAt: created.Add(time.Second)},
+		{Id: "done", AccountId: "me", Month: "2025-01", Status: JobSucceeded, CreatedAt: created.Add(2 * time.Second)},
+	} {
+		if err := store.SaveJob(t.Context(), job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The session store lost every session, as a memory store does on restart.
+	sessions := shared.NewSessions(shared.NewMemorySessionStore(), nil)
+	runner := NewJobRunner(log.New(io.Discard, "", 0), store, sessions, nil, shared.JiraConfig{}, 1)
+	if err := runner.Start(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"queued", "running"} {
+		job := waitForJob(t, store, id)
+		if job.Status != JobFailed || job.Error != jobErrorMessage(shared.ErrNoSession) {
+			t.Errorf("job %s = %s %q, want it to fail for the missing session", id, job.Status, job.Error)
+		}
+	}
+	if job, _ := store.GetJob(t.Context(), "done"); job.StartedAt != nil {
+		t.Error("a finished job was run again")
+	}
+}
+
+// rotatingTokens hands out a new access token on every refresh.
+type rotatingTokens struct{ refreshes int }
+
+func (g *rotatingTokens) ExchangeCode(context.Context, string, string) (shared.Oauth, error) {
+	return shared.Oauth{}, nil
+}
+
+func (g *rotatingTokens) Refresh(context.Context, string) (shared.Oauth, error) {
+	g.refreshes++
+	return shared.Oauth{AccessToken: "fresh", RefreshToken: "rotated", ExpiresIn: 3600}, nil
+}
+
+func (g *rotatingTokens) Revoke(context.Context, string) error {
+	return nil
+}
+
+func TestJobRunnerClientRefreshesSession(t *testing.T) {
+	store := shared.NewMemorySessionStore()
+	now := time.Now().UTC()
+	// The token was good when the job started and has expired since.
+	if err := store.Save(t.Context(), shared.Session{
+		Id:        "session",
+		Token:     shared.Oauth{AccessToken: "stale", RefreshToken: "refresh"},
+		Expiry:    now.Add(-time.Minute),
+		ExpiresAt: now.Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	tokens := &rotatingTokens{}
+	runner := NewJobRunner(log.New(io.Discard, "", 0), NewMemoryRepository(), shared.NewSessions(store, tokens), nil, shared.JiraConfig{ApiUrl: "https://api.example"}, 1)
+
+	for range 2 {
+		client, err := runner.client(t.Context(), "session", shared.Site{Id: "cloud"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if client.authorization != "Bearer fresh" || client.baseUrl != "https://api.example/ex/jira/cloud" {
+			t.Errorf("client = %s %s, want the refreshed token", client.baseUrl, client.authorization)
+		}
+	}
+	if tokens.refreshes != 1 {
+		t.Errorf("refreshed %d times, want once", tokens.refreshes)
+	}
+}
+
+// waitForJob polls until the job finishes.
+func waitForJob(t *testing.T, store Repository, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := store.GetJob(t.Context(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.finished() {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s still %s", id, job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
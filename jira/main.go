@@ -9,32 +9,103 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	// The alpine image has no zoneinfo; users' Jira time zones need it.
+	_ "time/tzdata"
 )
 
 type Config struct {
 	shared.ServerConfig
 	shared.JiraConfig
+	shared.SessionConfig
+	StoreConfig
 	LLMConfig
 }
 
-func addRoutes(mux *http.ServeMux, config *Config, log *log.Logger) {
-	allowMethod := shared.MethodGuard(log)
-	authGuard := shared.AuthGuard(log)
+// Services are built once in run and shared by every handler.
+type Services struct {
+	Tokens    shared.TokenGranter
+	Sessions  *shared.Sessions
+	Verifier  *shared.TokenVerifier
+	Store     Repository
+	Generator Generator
+	Jobs      *JobRunner
+}
+
+func NewServices(ctx context.Context, config *Config, log *log.Logger) (*Services, error) {
+	store, err := shared.NewSessionStore(config.SessionConfig)
+	if err != nil {
+		return nil, fmt.Errorf("session store: %w", err)
+	}
+
+	repository, err := NewRepository(config.StoreConfig)
+	if err != nil {
+		return nil, fmt.Errorf("data store: %w", err)
+	}
+
+	generator, err := NewGenerator(ctx, config.LLMConfig)
+	if err != nil {
+		return nil, fmt.Errorf("llm provider: %w", err)
+	}
 
-	mux.HandleFunc("/health", allowMethod(http.MethodGet, shared.HandleHealthCheck(log)))
-	mux.HandleFunc("/refresh", allowMethod(http.MethodPost, handleRefreshToken(log, config.JiraConfig)))
-	mux.HandleFunc("/oauth", allowMethod(http.MethodPost, handleGenerateToken(log, config.JiraConfig)))
-	mux.HandleFunc("/transform", allowMethod(http.MethodPost, authGuard(handlePartiallyGeneratedIssueTransform(log, config.LLMConfig))))
-	mux.Handle("/temp", http.StripPrefix("/", allowMethod(http.MethodGet, handleTempIssue(log))))
+	tokens := shared.NewTokenClient(config.JiraConfig)
+	sessions := shared.NewSessions(store, tokens)
+	return &Services{
+		Tokens:    tokens,
+		Sessions:  sessions,
+		Verifier:  shared.NewTokenVerifier(),
+		Store:     repository,
+		Generator: generator,
+		Jobs:      NewJobRunner(log, repository, sessions, generator, config.JiraConfig, config.LLMConfig.Workers),
+	}, nil
 }
 
-func ServerInstance(config *Config, log *log.Logger) http.Handler {
+func addRoutes(mux *http.ServeMux, config *Config, services *Services, log *log.Logger) {
+	authGuard := shared.AuthGuard(log, services.Sessions, services.Verifier, shared.NewScopes(shared.ScopeReadMe))
+	requireScopes := shared.RequireScopes(log)
+	jiraHttpClient := NewJiraHttpClient()
+
+	mux.HandleFunc("GET /health", shared.HandleHealthCheck(log))
+	mux.HandleFunc("POST /refresh", handleRefreshToken(log, services.Sessions))
+	mux.HandleFunc("POST /oauth", handleGenerateToken(log, config.JiraConfig, services.Tokens, services.Sessions, jiraHttpClient, shared.NewStateLedger()))
+	mux.HandleFunc("POST /logout", handleLogout(log, services.Sessions))
+	mux.HandleFunc("POST /credentials", handleAddApiToken(log, services.Sessions, services.Verifier))
+	mux.HandleFunc("POST /credentials/remove", authGuard(handleRemoveApiToken(log, services.Sessions)))
+	mux.HandleFunc("GET /session", authGuard(handleSessionInfo(log)))
+	mux.HandleFunc("GET /me", authGuard(handleCurrentUser(log)))
+	mux.HandleFunc("GET /sites", authGuard(handleListSites(log, jiraHttpClient)))
+	mux.HandleFunc("POST /sites/select", authGuard(handleSelectSite(log, jiraHttpClient, services.Sessions)))
+	mux.HandleFunc("GET /issues", authGuard(requireScopes(activityScopes, handleSearchIssues(log, config.JiraConfig, jiraHttpClient, services.Sessions))))
+	mux.HandleFunc("GET /worklogs", authGuard(requireScopes(worklogScopes, handleWorklogHours(log, config.JiraConfig, jiraHttpClient, services.Sessions))))
+	mux.HandleFunc("POST /transform", authGuard(requireScopes(issueScopes, handlePartiallyGeneratedIssueTransform(log, services.Generator, config.JiraConfig, jiraHttpClient, services.Sessions, services.Store))))
+	mux.HandleFunc("POST /transform/batch", authGuard(requireScopes(issueScopes, handleBatchTransform(log, services.Generator, config.LLMConfig.Workers, config.JiraConfig, jiraHttpClient, services.Sessions, services.Store))))
+	mux.HandleFunc("POST /transform/stream", authGuard(requireScopes(issueScopes, handleStreamTransform(log, services.Generator, config.LLMConfig.Workers, config.JiraConfig, jiraHttpClient, services.Sessions, services.Store))))
+	mux.HandleFunc("POST /reports", authGuard(requireScopes(reportScopes, handleCreateReport(log, services.Generator, config.JiraConfig, jiraHttpClient, services.Sessions, services.Store))))
+	mux.HandleFunc("GET /reports", authGuard(handleListReports(log, services.Store)))
+	mux.HandleFunc("GET /reports/{id}", authGuard(handleGetReport(log, services.Store)))
+	mux.HandleFunc("DELETE /reports/{id}", authGuard(handleDeleteReport(log, services.Store)))
+	mux.HandleFunc("POST /jobs", authGuard(requireScopes(reportScopes, handleCreateJob(log, services.Jobs, jiraHttpClient, services.Sessions, services.Store))))
+	mux.HandleFunc("GET /jobs", authGuard(handleListJobs(log, services.Store)))
+	mux.HandleFunc("GET /jobs/{id}", authGuard(handleGetJob(log, services.Store)))
+	mux.HandleFunc("POST /jobs/{id}/cancel", authGuard(handleCancelJob(log, services.Jobs, services.Store)))
+	mux.HandleFunc("POST /entries", authGuard(handleCreateEntry(log, services.Store)))
+	mux.HandleFunc("GET /entries", authGuard(handleListEntries(log, services.Store)))
+	mux.HandleFunc("GET /entries/{id}", authGuard(handleGetEntry(log, services.Store)))
+	mux.HandleFunc("PUT /entries/{id}", authGuard(handleUpdateEntry(log, services.Store)))
+	mux.HandleFunc("DELETE /entries/{id}", authGuard(handleDeleteEntry(log, services.Store)))
+	mux.HandleFunc("GET /entries/{id}/revisions", authGuard(handleListRevisions(log, services.Store)))
+	mux.HandleFunc("GET /entries/{id}/diff", authGuard(handleDiffRevisions(log, services.Store)))
+	mux.HandleFunc("POST /entries/{id}/revisions/{number}/restore", authGuard(handleRestoreRevision(log, services.Store)))
+	mux.Handle("GET /temp", http.StripPrefix("/", handleTempIssue(log)))
+}
+
+func ServerInstance(config *Config, services *Services, log *log.Logger) http.Handler {
 	mux := http.NewServeMux()
 	var handler http.Handler = mux
-	addRoutes(mux, config, log)
+	addRoutes(mux, config, services, log)
 	handler = shared.HandleCors(mux, log, config.ServerConfig)
 	return handler
 }
@@ -46,6 +117,19 @@ func GetConfig() *Config {
 			Cid:         os.Getenv("CLIENT_ID"),
 			Secret:      os.Getenv("CLIENT_SECRET"),
 			OauthUrl:    os.Getenv("OAUTH_URL"),
+			RevokeUrl:   os.Getenv("REVOKE_URL"),
+			ApiUrl:      getEnvDefault("JIRA_API_URL", shared.AtlassianApiUrl),
+			StateSecret: os.Getenv("STATE_SECRET"),
+			Pkce:        os.Getenv("OAUTH_PKCE") == "true",
+			Scopes:      shared.ScopesFromEnv(os.Getenv("OAUTH_SCOPES")),
+		},
+		SessionConfig: shared.SessionConfig{
+			Store: os.Getenv("SESSION_STORE"),
+			Path:  getEnvDefault("SESSION_FILE", "jira/_data/sessions.json"),
+		},
+		StoreConfig: StoreConfig{
+			Store: os.Getenv("DATA_STORE"),
+			Path:  getEnvDefault("DATA_FILE", "jira/_data/store.json"),
 		},
 		ServerConfig: shared.ServerConfig{
 			Port:           os.Getenv("PORT"),
@@ -55,11 +139,32 @@ func GetConfig() *Config {
 			AllowedHeaders: strings.Split(os.Getenv("ALLOWED_HEADERS"), ","),
 		},
 		LLMConfig: LLMConfig{
-			ApiKey: os.Getenv("LLM_API_KEY"),
+			Provider:  os.Getenv("LLM_PROVIDER"),
+			Model:     os.Getenv("LLM_MODEL"),
+			Endpoint:  os.Getenv("LLM_ENDPOINT"),
+			ApiKey:    os.Getenv("LLM_API_KEY"),
+			RateLimit: getEnvInt("LLM_RATE_LIMIT", -1),
+			Workers:   getEnvInt("LLM_WORKERS", 4),
 		},
 	}
 }
 
+func getEnvDefault(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt falls back when the variable is unset or not a number.
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
 func run(ctx context.Context) error {
 	config := GetConfig()
 	logger := log.New(os.Stdout, "["+config.ServiceName+"] ", log.LstdFlags|log.Lshortfile)
@@ -67,7 +172,26 @@ func run(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	srv := ServerInstance(config, logger)
+	if err := config.Scopes.Validate(); err != nil {
+		return err
+	}
+	if err := shared.ValidateStateSecret(config.StateSecret); err != nil {
+		return err
+	}
+	config.SessionConfig = jobSessionStore(config.StoreConfig, config.SessionConfig)
+	if err := validateJobStores(config.StoreConfig, config.SessionConfig); err != nil {
+		logger.Println("warning:", err)
+	}
+
+	services, err := NewServices(ctx, config, logger)
+	if err != nil {
+		return err
+	}
+	if err := services.Jobs.Start(ctx); err != nil {
+		return fmt.Errorf("resume jobs: %w", err)
+	}
+
+	srv := ServerInstance(config, services, logger)
 	httpServer := &http.Server{
 		Addr:    net.JoinHostPort(config.Host, config.Port),
 		Handler: srv,
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A minimal PDF 1.4 writer: the standard Helvetica fonts, wrapped text,
+// rules and link annotations. It exists so reports can be rendered without
+// cgo or system packages in the alpine image.
+
+const (
+	pdfPageWidth  = 595.28 // A4 in points
+	pdfPageHeight = 841.89
+	pdfMargin     = 56.0
+)
+
+type pdfFont int
+
+const (
+	fontRegular pdfFont = iota
+	fontBold
+)
+
+var pdfFontNames = map[pdfFont]string{
+	fontRegular: "Helvetica",
+	fontBold:    "Helvetica-Bold",
+}
+
+// Glyph widths for ASCII 32-126 in 1/1000 em, from the Adobe core font
+// metrics.
+var pdfFontWidths = map[pdfFont][95]int{
+	fontRegular: {
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	},
+	fontBold: {
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	},
+}
+
+// winAnsiExtras are the characters WinAnsiEncoding places in 0x80-0x9F.
+// Latin-1 (0xA0-0xFF) maps straight across.
+var winAnsiExtras = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91,
+	'’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98,
+	'™': 0x99, 'š': 0x9A, '›': 0x9B, 'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F, '→': '>',
+}
+
+func winAnsi(text string) []byte {
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r == '\t':
+			out = append(out, ' ')
+		case r >= 32 && r <= 126, r >= 0xA0 && r <= 0xFF:
+			out = append(out, byte(r))
+		case winAnsiExtras[r] != 0:
+			out = append(out, winAnsiExtras[r])
+		case r >= 32:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+func textWidth(text string, font pdfFont, size float64) float64 {
+	widths := pdfFontWidths[font]
+	total := 0
+	for _, b := range winAnsi(text) {
+		if b >= 32 && b <= 126 {
+			total += widths[b-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// wrapText breaks text into lines no wider than width, keeping explicit line
+// breaks. A single word wider than the line is split by character.
+func wrapText(text string, font pdfFont, size float64, width float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		words := strings.Fields(paragraph)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+
+		line := ""
+		for _, word := range words {
+			for textWidth(word, font, size) > width {
+				runes := []rune(word)
+				cut := len(runes)
+				for cut > 1 && textWidth(string(runes[:cut]), font, size) > width {
+					cut--
+				}
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				lines = append(lines, string(runes[:cut]))
+				word = string(runes[cut:])
+			}
+
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if textWidth(candidate, font, size) > width && line != "" {
+				lines = append(lines, line)
+				candidate = word
+			}
+			line = candidate
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func pdfString(text string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, c := range winAnsi(text) {
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+type pdfLink struct {
+	x, y, w, h float64
+	url        string
+}
+
+type pdfPage struct {
+	content bytes.Buffer
+	links   []pdfLink
+}
+
+// PDFDocument lays text out top to bottom, starting a new page whenever the
+// next line wouldn't fit.
+type PDFDocument struct {
+	Title  string
+	Author string
+
+	pages []*pdfPage
+	y     float64
+}
+
+func NewPDFDocument(title string, author string) *PDFDocument {
+	doc := &PDFDocument{Title: title, Author: author}
+	doc.NewPage()
+	return doc
+}
+
+func (d *PDFDocument) page() *pdfPage {
+	return d.pages[len(d.pages)-1]
+}
+
+func (d *PDFDocument) NewPage() {
+	d.pages = append(d.pages, &pdfPage{})
+	d.y = pdfPageHeight - pdfMargin
+}
+
+func (d *PDFDocument) contentWidth() float64 {
+	return pdfPageWidth - 2*pdfMargin
+}
+
+// ensure starts a new page unless height more points fit on this one.
+func (d *PDFDocument) ensure(height float64) {
+	if d.y-height < pdfMargin {
+		d.NewPage()
+	}
+}
+
+func (d *PDFDocument) Space(height float64) {
+	d.y -= height
+}
+
+func (d *PDFDocument) textAt(x float64, y float64, text string, font pdfFont, size float64) {
+	fmt.Fprintf(&d.page().content, "BT /F%d %.2f Tf %.2f %.2f Td %s Tj ET\n", font+1, size, x, y, pdfString(text))
+}
+
+// Paragraph writes wrapped text and moves below it.
+func (d *PDFDocument) Paragraph(text string, font pdfFont, size float64) {
+	leading := size * 1.35
+	for _, line := range wrapText(text, font, size, d.contentWidth()) {
+		d.ensure(leading)
+		d.y -= leading
+		if line != "" {
+			d.textAt(pdfMargin, d.y, line, font, size)
+		}
+	}
+}
+
+// Link writes text that opens url when clicked.
+func (d *PDFDocument) Link(text string, url string, size float64) {
+	leading := size * 1.35
+	for _, line := range wrapText(text, fontRegular, size, d.contentWidth()) {
+		d.ensure(leading)
+		d.y -= leading
+		fmt.Fprintf(&d.page().content, "0 0 0.8 rg\n")
+		d.textAt(pdfMargin, d.y, line, fontRegular, size)
+		fmt.Fprintf(&d.page().content, "0 0 0 rg\n")
+		d.page().links = append(d.page().links, pdfLink{
+			x: pdfMargin, y: d.y - size*0.25,
+			w: textWidth(line, fontRegular, size), h: size * 1.1,
+			url: url,
+		})
+	}
+}
+
+// Rule draws a horizontal line across the content width.
+func (d *PDFDocument) Rule() {
+	d.ensure(12)
+	d.y -= 6
+	fmt.Fprintf(&d.page().content, "0.6 G 0.5 w %.2f %.2f m %.2f %.2f l S 0 G\n", pdfMargin, d.y, pdfPageWidth-pdfMargin, d.y)
+	d.y -= 6
+}
+
+// Bytes serialises the document, numbering each page in its footer.
+func (d *PDFDocument) Bytes(created time.Time) []byte {
+	var out bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	stream := func(data []byte) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n<< /Length %d >>\nstream\n", len(offsets), len(data))
+		out.Write(data)
+		out.WriteString("\nendstream\nendobj\n")
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-4 are fixed; each page then takes its page, content and
+	// annotation objects in turn.
+	const firstPageObject = 5
+	objectsPerPage := 2
+	var kids []string
+	next := firstPageObject
+	for _, page := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", next))
+		next += objectsPerPage + len(page.links)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", pdfFontNames[fontRegular]))
+	object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", pdfFontNames[fontBold]))
+
+	for i, page := range d.pages {
+		pageObject := len(offsets) + 1
+		var annots []string
+		for j := range page.links {
+			annots = append(annots, fmt.Sprintf("%d 0 R", pageObject+2+j))
+		}
+
+		footer := fmt.Sprintf("Page %d of %d", i+1, len(d.pages))
+		content := bytes.NewBuffer(append([]byte(nil), page.content.Bytes()...))
+		fmt.Fprintf(content, "0.4 g BT /F1 8 Tf %.2f %.2f Td %s Tj ET 0 g\n",
+			pdfPageWidth-pdfMargin-textWidth(footer, fontRegular, 8), pdfMargin/2, pdfString(footer))
+
+		object(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R /Annots [%s] >>",
+			pdfPageWidth, pdfPageHeight, pageObject+1, strings.Join(annots, " "),
+		))
+		stream(content.Bytes())
+		for _, link := range page.links {
+			object(fmt.Sprintf(
+				"<< /Type /Annot /Subtype /Link /Rect [%.2f %.2f %.2f %.2f] /Border [0 0 0] /A << /S /URI /URI %s >> >>",
+				link.x, link.y, link.x+link.w, link.y+link.h, pdfString(link.url),
+			))
+		}
+	}
+
+	object(fmt.Sprintf("<< /Title %s /Author %s /Producer (JiraConnect) /CreationDate (D:%s) >>",
+		pdfString(d.Title), pdfString(d.Author), created.UTC().Format("20060102150405Z")))
+	info := len(offsets)
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, info, xref)
+	return out.Bytes()
+}
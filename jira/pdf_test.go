@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testReport is a small finished report shared by the export tests.
+func testReport() Report {
+	return Report{
+		Id:        "report",
+		AccountId: "me",
+		Header: ReportHeader{
+			Employee:    "Ann Example",
+			Email:       "ann@example.com",
+			AccountId:   "me",
+			Site:        "https://example.atlassian.net",
+			Month:       "2025-01",
+			Start:       "2025-01-01",
+			End:         "2025-01-31",
+			GeneratedAt: time.Date(2025, 2, 1, 9, 0, 0, 0, time.UTC),
+		},
+		Entries: []Entry{
+			{
+				Key:         "ABC-1",
+				Url:         "https://example.atlassian.net/browse/ABC-1",
+				Heading:     "Designed the import pipeline",
+				Description: "Worked out how files are matched.\nWrote the parser.",
+				Links:       []string{"https://example.atlassian.net/browse/ABC-1"},
+				Hours:       6,
+			},
+			{
+				Key:         "ABC-2",
+				Url:         "https://example.atlassian.net/browse/ABC-2",
+				Heading:     "Reworked the export",
+				Description: "Split exports by format.",
+				Hours:       2,
+			},
+		},
+		Totals: ReportTotals{Issues: 2, Entries: 2, Hours: 10, CreativeHours: 8, CreativeShare: 80},
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "plain", want: "(plain)"},
+		{text: `a (b) \ c`, want: `(a \(b\) \\ c)`},
+		{text: "tab\there", want: "(tab here)"},
+		{text: "line\nbreak", want: "(linebreak)"},
+		{text: "café – 5€", want: "(caf\xe9 \x96 5\x80)"},
+		{text: "日本", want: "(??)"},
+	}
+	for _, tt := range tests {
+		if got := pdfString(tt.text); got != tt.want {
+			t.Errorf("pdfString(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	const size = 10.0
+	width := textWidth("the quick brown", fontRegular, size)
+
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "fits", text: "short", want: []string{"short"}},
+		{name: "wraps at words", text: "the quick brown fox jumps", want: []string{"the quick brown", "fox jumps"}},
+		{name: "keeps line breaks", text: "one\n\ntwo", want: []string{"one", "", "two"}},
+		{name: "collapses spaces", text: "a   b", want: []string{"a b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := wrapText(tt.text, fontRegular, size, width)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("wrapText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	long := strings.Repeat("x", 200)
+	lines := wrapText(long, fontBold, size, width)
+	if len(lines) < 2 || strings.Join(lines, "") != long {
+		t.Fatalf("long word split into %q", lines)
+	}
+	for _, line := range lines {
+		if textWidth(line, fontBold, size) > width {
+			t.Errorf("line %q is wider than %.2f", line, width)
+		}
+	}
+}
+
+var pdfObjectPattern = regexp.MustCompile(`(?m)^(\d+) 0 obj$`)
+
+// checkPDF verifies the cross-reference table points at every object and
+// returns the number of pages.
+func checkPDF(t *testing.T, out []byte) int {
+	t.Helper()
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatal("missing PDF header or trailer")
+	}
+
+	startxref := bytes.LastIndex(out, []byte("startxref\n"))
+	xref, err := strconv.Atoi(strings.Fields(string(out[startxref+len("startxref\n"):]))[0])
+	if err != nil || !bytes.HasPrefix(out[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d doesn't point at the xref table", xref)
+	}
+
+	objects := pdfObjectPattern.FindAllSubmatchIndex(out, -1)
+	table := strings.Split(string(out[xref:]), "\n")[3:]
+	for i, match := range objects {
+		number, _ := strconv.Atoi(string(out[match[2]:match[3]]))
+		if number != i+1 {
+			t.Fatalf("object %d is numbered %d", i+1, number)
+		}
+		if want := fmt.Sprintf("%010d 00000 n ", match[0]); table[i] != want {
+			t.Errorf("xref entry %d = %q, want %q", number, table[i], want)
+		}
+	}
+
+	count := regexp.MustCompile(`/Type /Pages /Kids \[[^\]]*\] /Count (\d+)`).FindSubmatch(out)
+	if count == nil {
+		t.Fatal("no page tree")
+	}
+	pages, _ := strconv.Atoi(string(count[1]))
+	return pages
+}
+
+func TestPDFDocumentBytes(t *testing.T) {
+	doc := NewPDFDocument("Title (draft)", "Ann")
+	doc.Paragraph("First page", fontBold, 12)
+	doc.Link("example", "https://example.com/a", 10)
+	doc.Rule()
+	for i := range 80 {
+		doc.Paragraph(fmt.Sprintf("Line %d", i), fontRegular, 11)
+	}
+
+	out := doc.Bytes(time.Date(2025, 2, 1, 9, 0, 0, 0, time.UTC))
+	pages := checkPDF(t, out)
+	if pages != len(doc.pages) || pages < 2 {
+		t.Errorf("page tree counts %d pages, document has %d", pages, len(doc.pages))
+	}
+	for _, want := range []string{
+		"/Title (Title \\(draft\\)) /Author (Ann)",
+		"/CreationDate (D:20250201090000Z)",
+		"/URI (https://example.com/a)",
+		fmt.Sprintf("(Page %d of %d)", pages, pages),
+	} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("output is missing %q", want)
+		}
+	}
+}
+
+func TestRenderReportPDF(t *testing.T) {
+	out, err := renderReportPDF(testReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages := checkPDF(t, out); pages != 2 {
+		t.Errorf("report has %d pages, want a title page and one for entries", pages)
+	}
+	for _, want := range []string{"(Designed the import pipeline)", "(Wrote the parser.)", "/URI (https://example.atlassian.net/browse/ABC-1)"} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("report is missing %q", want)
+		}
+	}
+}
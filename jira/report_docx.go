@@ -0,0 +1,43 @@
+package main
+
+// renderReportDOCX lays the report out like the PDF, but with Word styles so
+// it can be edited before it is signed.
+func renderReportDOCX(report Report) ([]byte, error) {
+	content := newReportDocument(report)
+	doc := NewDOCXDocument(content.Title, content.Author)
+
+	doc.Paragraph(content.Title, docxStyleTitle)
+	for _, detail := range content.Details {
+		doc.Paragraph(detail.Label, docxStyleLabel)
+		doc.Paragraph(detail.Value, "")
+	}
+
+	doc.Paragraph("", "")
+	for _, signature := range content.Signatures {
+		doc.Paragraph("", "")
+		doc.Paragraph(signature, "")
+	}
+
+	doc.PageBreak()
+	for i, section := range content.Sections {
+		if i > 0 {
+			doc.Rule()
+		}
+
+		doc.Paragraph(section.Heading, docxStyleHeading)
+		doc.Paragraph(section.Meta, docxStyleMeta)
+		doc.Paragraph(section.Body, "")
+
+		if len(section.Links) > 0 {
+			doc.Paragraph("Links:", docxStyleLabel)
+			for _, link := range section.Links {
+				doc.Link(link, link)
+			}
+		}
+	}
+	if len(content.Sections) == 0 {
+		doc.Paragraph(content.Empty, "")
+	}
+
+	return doc.Bytes(content.Created)
+}
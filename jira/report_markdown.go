@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// renderReportMarkdown writes the report with entries in the layout of
+// templates/style-guide.md, ending each with its **Links:** block.
+func renderReportMarkdown(report Report) ([]byte, error) {
+	content := newReportDocument(report)
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n\n", content.Title)
+	for _, detail := range content.Details {
+		fmt.Fprintf(&b, "**%s:** %s  \n", detail.Label, detail.Value)
+	}
+	b.WriteString("\n")
+	for _, signature := range content.Signatures {
+		fmt.Fprintf(&b, "%s\n\n", signature)
+	}
+
+	if len(content.Sections) == 0 {
+		fmt.Fprintf(&b, "---\n\n%s\n", content.Empty)
+	}
+	for _, section := range content.Sections {
+		b.WriteString("---\n\n")
+		fmt.Fprintf(&b, "### **%s**\n\n", section.Heading)
+		fmt.Fprintf(&b, "*%s*\n\n", section.Meta)
+		fmt.Fprintf(&b, "%s\n\n", strings.TrimSpace(section.Body))
+
+		if len(section.Links) > 0 {
+			b.WriteString("**Links:**  \n")
+			for _, link := range section.Links {
+				fmt.Fprintf(&b, "[%s](%s)  \n", link, link)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	return []byte(b.String()), nil
+}
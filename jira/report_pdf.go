@@ -0,0 +1,48 @@
+package main
+
+// renderReportPDF writes a title page with the employee, period and creative
+// share, space to sign, then one section per entry.
+func renderReportPDF(report Report) ([]byte, error) {
+	content := newReportDocument(report)
+	doc := NewPDFDocument(content.Title, content.Author)
+
+	doc.Paragraph(content.Title, fontBold, 20)
+	doc.Space(18)
+	for _, detail := range content.Details {
+		doc.Paragraph(detail.Label, fontBold, 9)
+		doc.Paragraph(detail.Value, fontRegular, 12)
+		doc.Space(6)
+	}
+
+	doc.Space(18)
+	for _, signature := range content.Signatures {
+		doc.Space(30)
+		doc.Paragraph(signature, fontRegular, 11)
+	}
+
+	doc.NewPage()
+	for i, section := range content.Sections {
+		if i > 0 {
+			doc.Space(6)
+			doc.Rule()
+		}
+
+		doc.Paragraph(section.Heading, fontBold, 13)
+		doc.Paragraph(section.Meta, fontRegular, 8.5)
+		doc.Space(4)
+		doc.Paragraph(section.Body, fontRegular, 10.5)
+
+		if len(section.Links) > 0 {
+			doc.Space(4)
+			doc.Paragraph("Links:", fontBold, 10)
+			for _, link := range section.Links {
+				doc.Link(link, link, 9.5)
+			}
+		}
+	}
+	if len(content.Sections) == 0 {
+		doc.Paragraph(content.Empty, fontRegular, 11)
+	}
+
+	return doc.Bytes(content.Created), nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportDocument is the report as every export lays it out, so the PDF, DOCX
+// and Markdown files agree on wording and order.
+type reportDocument struct {
+	Title      string
+	Author     string
+	Created    time.Time
+	Details    []reportDetail
+	Signatures []string
+	Sections   []entrySection
+	// Empty is shown in place of the sections when there are none.
+	Empty string
+}
+
+type reportDetail struct {
+	Label string
+	Value string
+}
+
+type entrySection struct {
+	Heading string
+	Meta    string
+	Body    string
+	Links   []string
+}
+
+func newReportDocument(report Report) reportDocument {
+	header := report.Header
+	doc := reportDocument{
+		Title:   reportTitle(report),
+		Author:  header.Employee,
+		Created: header.GeneratedAt,
+		Signatures: []string{
+			"Employee signature: ______________________________     Date: ______________",
+			"Approved by: ______________________________     Date: ______________",
+		},
+		Empty: "No qualifying issues were found for this period.",
+	}
+
+	details := []reportDetail{
+		{"Employee", header.Employee},
+		{"Email", header.Email},
+		{"Jira site", header.Site},
+		{"Period", header.Start + " to " + header.End},
+		{"Creative work", creativeSummary(report.Totals)},
+		{"Entries", fmt.Sprintf("%d of %d issues", report.Totals.Entries, report.Totals.Issues)},
+		{"Generated", header.GeneratedAt.Format("2 January 2006 15:04 MST")},
+		{"Prompt version", report.PromptVersion},
+	}
+	for _, detail := range details {
+		if detail.Value != "" {
+			doc.Details = append(doc.Details, detail)
+		}
+	}
+
+	for _, entry := range report.Entries {
+		meta := []string{entry.Key}
+		if entry.Hours > 0 {
+			meta = append(meta, formatHours(entry.Hours))
+		}
+		if entry.Source != "" && entry.Source != RevisionSourceModel {
+			meta = append(meta, "reviewed and edited")
+		}
+
+		body := entry.Description
+		if entry.Error != "" && body == "" {
+			body = "No entry text: " + entry.Error
+		}
+
+		doc.Sections = append(doc.Sections, entrySection{
+			Heading: entry.Heading,
+			Meta:    strings.Join(meta, "  |  "),
+			Body:    body,
+			Links:   entryLinks(entry),
+		})
+	}
+	return doc
+}
+
+func reportTitle(report Report) string {
+	month, err := time.Parse(reportMonthLayout, report.Header.Month)
+	if err != nil {
+		return "Creative Work Report"
+	}
+	return "Creative Work Report - " + month.Format("January 2006")
+}
+
+func formatHours(hours float64) string {
+	return strconv.FormatFloat(hours, 'f', -1, 64) + " h"
+}
+
+// creativeSummary is the line auditors look for first: how much of the
+// month's logged time went on creative work.
+func creativeSummary(totals ReportTotals) string {
+	if totals.Hours == 0 {
+		return "No time logged in Jira for this period"
+	}
+	return fmt.Sprintf("%s of %s logged (%s%%)",
+		formatHours(totals.CreativeHours),
+		formatHours(totals.Hours),
+		strconv.FormatFloat(totals.CreativeShare, 'f', -1, 64),
+	)
+}
+
+// entryLinks lists whatever the entry cites, then the issue itself, in the
+// order the style guide's sample entry uses.
+func entryLinks(entry Entry) []string {
+	links := []string{}
+	for _, link := range entry.Links {
+		if link != "" && link != entry.Url {
+			links = append(links, link)
+		}
+	}
+	if entry.Url != "" {
+		links = append(links, entry.Url)
+	}
+	return links
+}
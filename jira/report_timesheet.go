@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// timesheetColumns are the columns the HR import expects, in order.
+var timesheetColumns = []string{"Issue key", "Title", "Month", "Hours", "Creative %", "Link"}
+
+// timesheetRow is one qualifying issue, with its share of the month's logged
+// hours as the creative percentage.
+type timesheetRow struct {
+	Key      string
+	Title    string
+	Month    string
+	Hours    float64
+	Creative float64
+	Link     string
+}
+
+// newTimesheet lists the report's entries and, last, a total row matching
+// the report's totals.
+func newTimesheet(report Report) []timesheetRow {
+	month := report.Header.Month
+	rows := make([]timesheetRow, 0, len(report.Entries)+1)
+	for _, entry := range report.Entries {
+		creative := 0.0
+		if report.Totals.Hours > 0 {
+			creative = math.Round(entry.Hours/report.Totals.Hours*1000) / 10
+		}
+		rows = append(rows, timesheetRow{
+			Key:      entry.Key,
+			Title:    entry.Heading,
+			Month:    month,
+			Hours:    entry.Hours,
+			Creative: creative,
+			Link:     entry.Url,
+		})
+	}
+	return append(rows, timesheetRow{
+		Title:    "Total",
+		Month:    month,
+		Hours:    report.Totals.CreativeHours,
+		Creative: report.Totals.CreativeShare,
+	})
+}
+
+// formulaPrefixes make a spreadsheet read a CSV cell as a formula.
+const formulaPrefixes = "=+-@\t\r"
+
+// csvText stops text from Jira, such as an issue titled "=HYPERLINK(...)",
+// running as a formula when the CSV is opened, by starting it with the
+// apostrophe spreadsheets use to mark a cell as text.
+func csvText(text string) string {
+	if text != "" && strings.ContainsRune(formulaPrefixes, rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+func renderReportCSV(report Report) ([]byte, error) {
+	var out bytes.Buffer
+	writer := csv.NewWriter(&out)
+	if err := writer.Write(timesheetColumns); err != nil {
+		return nil, fmt.Errorf("write csv header: %w", err)
+	}
+
+	for _, row := range newTimesheet(report) {
+		record := []string{
+			csvText(row.Key),
+			csvText(row.Title),
+			csvText(row.Month),
+			strconv.FormatFloat(row.Hours, 'f', -1, 64),
+			strconv.FormatFloat(row.Creative, 'f', -1, 64),
+			csvText(row.Link),
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, fmt.Errorf("write csv row: %w", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("write csv: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// renderReportXLSX needs no csvText: the sheet writes text as inline strings,
+// which are never evaluated as formulas.
+func renderReportXLSX(report Report) ([]byte, error) {
+	sheet := NewXLSXSheet("Timesheet " + report.Header.Month)
+	sheet.Columns(12, 50, 10, 10, 12, 45)
+
+	header := make([]any, len(timesheetColumns))
+	for i, column := range timesheetColumns {
+		header[i] = column
+	}
+	sheet.Row(true, header...)
+
+	rows := newTimesheet(report)
+	for i, row := range rows {
+		total := i == len(rows)-1
+		sheet.Row(total, row.Key, row.Title, row.Month, row.Hours, row.Creative, row.Link)
+	}
+
+	return sheet.Bytes(report.Header.GeneratedAt)
+}
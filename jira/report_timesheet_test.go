@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "", want: ""},
+		{text: "Designed the importer", want: "Designed the importer"},
+		{text: "ABC-1", want: "ABC-1"},
+		{text: "=HYPERLINK(\"https://evil.example\")", want: "'=HYPERLINK(\"https://evil.example\")"},
+		{text: "+1 for caching", want: "'+1 for caching"},
+		{text: "-2 days estimate", want: "'-2 days estimate"},
+		{text: "@SUM(A1)", want: "'@SUM(A1)"},
+		{text: "\tindented", want: "'\tindented"},
+		{text: "\rreturn", want: "'\rreturn"},
+		{text: "a=b", want: "a=b"},
+	}
+	for _, tt := range tests {
+		if got := csvText(tt.text); got != tt.want {
+			t.Errorf("csvText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestRenderReportCSV(t *testing.T) {
+	report := testReport()
+	report.Entries[1].Heading = "=cmd|'/C calc'!A0"
+
+	out, err := renderReportCSV(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		timesheetColumns,
+		{"ABC-1", "Designed the import pipeline", "2025-01", "6", "60", "https://example.atlassian.net/browse/ABC-1"},
+		{"ABC-2", "'=cmd|'/C calc'!A0", "2025-01", "2", "20", "https://example.atlassian.net/browse/ABC-2"},
+		{"", "Total", "2025-01", "8", "80", ""},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("csv =\n%q\nwant\n%q", records, want)
+	}
+}
+
+func TestRenderReportXLSX(t *testing.T) {
+	report := testReport()
+	report.Entries[1].Heading = "=cmd|'/C calc'!A0"
+
+	out, err := renderReportXLSX(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := openXMLParts(t, out)["xl/worksheets/sheet1.xml"]
+
+	// Formula-like titles stay inline strings, so they need no apostrophe.
+	if !strings.Contains(data, `<c r="B3" s="0" t="inlineStr"><is><t xml:space="preserve">=cmd|&#39;/C calc&#39;!A0</t></is></c>`) {
+		t.Errorf("the formula-like title isn't an inline string:\n%s", data)
+	}
+	if !strings.Contains(data, `<c r="B4" s="1" t="inlineStr"><is><t xml:space="preserve">Total</t></is></c><c r="C4" s="1" t="inlineStr"><is><t xml:space="preserve">2025-01</t></is></c><c r="D4" s="3"><v>8</v></c><c r="E4" s="3"><v>80</v></c>`) {
+		t.Errorf("the total row isn't bold with the report's totals:\n%s", data)
+	}
+}
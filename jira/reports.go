@@ -0,0 +1,571 @@
+package main
+
+import (
+	"JiraConnect/shared"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const reportMonthLayout = "2006-01"
+
+var reportScopes = shared.NewScopes(append(activityScopes, shared.ScopeReadIssueWorklog)...)
+
+type ReportRequest struct {
+	Month string `json:"month"`
+}
+
+type ReportHeader struct {
+	Employee    string    `json:"employee"`
+	Email       string    `json:"email"`
+	AccountId   string    `json:"accountId"`
+	Site        string    `json:"site"`
+	Month       string    `json:"month"`
+	Start       string    `json:"start"`
+	End         string    `json:"end"`
+	GeneratedAt time.Time `json:"generatedAt"`
+}
+
+// Entry is one generated write-up, either part of a report or generated on
+// its own from /transform, in which case ReportId is empty.
+type Entry struct {
+	Id            string    `json:"id"`
+	ReportId      string    `json:"reportId,omitempty"`
+	AccountId     string    `json:"accountId"`
+	Key           string    `json:"key"`
+	Url           string    `json:"url"`
+	Heading       string    `json:"heading"`
+	Description   string    `json:"description"`
+	Links         []string  `json:"links"`
+	Hours         float64   `json:"hours"`
+	Reasons       []string  `json:"reasons"`
+	Error         string    `json:"error,omitempty"`
+	PromptVersion string    `json:"promptVersion"`
+	Revision      int       `json:"revision"`
+	Source        string    `json:"source"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// ReportTotals counts the report. Hours is all time logged in the month;
+// CreativeHours is the part logged on the report's issues, and CreativeShare
+// is that as a percentage.
+type ReportTotals struct {
+	Issues        int     `json:"issues"`
+	Entries       int     `json:"entries"`
+	Failed        int     `json:"failed"`
+	Hours         float64 `json:"hours"`
+	CreativeHours float64 `json:"creativeHours"`
+	CreativeShare float64 `json:"creativeShare"`
+}
+
+type Report struct {
+	Id            string       `json:"id"`
+	AccountId     string       `json:"accountId"`
+	Header        ReportHeader `json:"header"`
+	Entries       []Entry      `json:"entries"`
+	Totals        ReportTotals `json:"totals"`
+	Links         []string     `json:"links"`
+	PromptVersion string       `json:"promptVersion"`
+	CreatedAt     time.Time    `json:"createdAt"`
+	UpdatedAt     time.Time    `json:"updatedAt"`
+}
+
+// monthPeriod turns YYYY-MM into the period covering that whole month in loc.
+func monthPeriod(month string, loc *time.Location) (Period, error) {
+	start, err := time.ParseInLocation(reportMonthLayout, month, loc)
+	if err != nil {
+		return Period{}, fmt.Errorf("invalid month %q, expected YYYY-MM", month)
+	}
+	return Period{Start: start, End: start.AddDate(0, 1, -1)}, nil
+}
+
+// newReport is the empty report for the user's month, before any entries
+// are generated.
+func newReport(site shared.Site, user shared.User, period Period) Report {
+	return Report{
+		AccountId: user.AccountId,
+		Header: ReportHeader{
+			Employee:    user.Name,
+			Email:       user.Email,
+			AccountId:   user.AccountId,
+			Site:        site.Url,
+			Month:       period.Start.Format(reportMonthLayout),
+			Start:       period.Start.Format(issueDateLayout),
+			End:         period.End.Format(issueDateLayout),
+			GeneratedAt: time.Now().UTC(),
+		},
+		Entries: []Entry{},
+		Links:   []string{},
+	}
+}
+
+// reportIssues lists the issues the user worked on in the period, by key,
+// with the hours logged on each and in total. Missing worklogs only cost the
+// hours, so they are logged rather than failing the report.
+func reportIssues(ctx context.Context, log *log.Logger, client *JiraClient, site shared.Site, accountId string, period Period) ([]Issue, map[string]float64, float64, error) {
+	issues, err := client.MonthlyIssues(ctx, log, site, accountId, IssueQuery{Start: period.Start, End: period.End})
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	sortIssuesByKey(issues)
+
+	hours := map[string]float64{}
+	worklogs, err := client.SummariseWorklogs(ctx, site, accountId, period)
+	if err != nil {
+		log.Println("report worklog error:", err)
+	}
+	for _, issue := range worklogs.Issues {
+		hours[issue.Key] = issue.Hours
+	}
+	return issues, hours, worklogs.TotalHours, nil
+}
+
+// reportEntry generates the entry for one of a report's issues, keeping a
+// failure as the entry's error.
+func reportEntry(ctx context.Context, log *log.Logger, generator Generator, client *JiraClient, accountId string, issue Issue, hours float64, filter CommentFilter) Entry {
+	entry := Entry{
+		AccountId: accountId,
+		Key:       issue.Key,
+		Url:       issue.Url,
+		Heading:   issue.Summary,
+		Links:     []string{},
+		Hours:     hours,
+	}
+	if issue.Activity != nil {
+		entry.Reasons = issue.Activity.Reasons
+	}
+
+	content, err := client.IssueContent(ctx, log, issue.Key, filter)
+	if err == nil {
+		var result LLMResponse
+		if result, err = generateEntry(ctx, generator, content); err == nil {
+			entry.Heading = result.Heading
+			entry.Description = result.Description
+			entry.Links = append(entry.Links, result.Links...)
+			entry.PromptVersion = result.PromptVersion
+		}
+	}
+	if err != nil {
+		log.Printf("report entry %s failed: %v\n", issue.Key, err)
+		entry.Error = "generation failed"
+	}
+	return entry
+}
+
+// BuildReport generates an entry for every issue the user worked on in the
+// period. An issue that fails to generate is kept with its error so the
+// report shows what is missing instead of silently dropping it.
+func BuildReport(ctx context.Context, log *log.Logger, generator Generator, client *JiraClient, site shared.Site, user shared.User, period Period) (Report, error) {
+	report := newReport(site, user, period)
+
+	issues, hours, totalHours, err := reportIssues(ctx, log, client, site, user.AccountId, period)
+	if err != nil {
+		return report, err
+	}
+
+	filter := CommentFilter{AccountId: user.AccountId, Period: &period}
+	for _, issue := range issues {
+		// Once the caller gives up there is no point generating the rest.
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		entry := reportEntry(ctx, log, generator, client, user.AccountId, issue, hours[issue.Key], filter)
+		if report.PromptVersion == "" {
+			report.PromptVersion = entry.PromptVersion
+		}
+		report.Entries = append(report.Entries, entry)
+	}
+
+	report.Totals, report.Links = reportTotals(report.Entries, totalHours)
+	return report, nil
+}
+
+// reportTotals sums the entries and collects every link once, in entry order.
+// Hours come from the worklog summary so time logged on issues without an
+// entry is still counted.
+func reportTotals(entries []Entry, hours float64) (ReportTotals, []string) {
+	totals := ReportTotals{Issues: len(entries), Hours: hours}
+	links := []string{}
+	seen := map[string]bool{}
+
+	for _, entry := range entries {
+		if entry.Error != "" {
+			totals.Failed++
+		} else {
+			totals.Entries++
+		}
+		totals.CreativeHours += entry.Hours
+		for _, link := range entry.Links {
+			if link != "" && !seen[link] {
+				seen[link] = true
+				links = append(links, link)
+			}
+		}
+	}
+	totals.CreativeHours = math.Round(totals.CreativeHours*100) / 100
+	if totals.Hours > 0 {
+		totals.CreativeShare = math.Round(totals.CreativeHours/totals.Hours*1000) / 10
+	}
+	return totals, links
+}
+
+func sortIssuesByKey(issues []Issue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issueKeyLess(issues[i].Key, issues[j].Key)
+	})
+}
+
+// sortEntries keeps report order stable: by issue key, then oldest first.
+func sortEntries(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Key != entries[j].Key {
+			return issueKeyLess(entries[i].Key, entries[j].Key)
+		}
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+}
+
+// sortReports puts the latest month first.
+func sortReports(reports []Report) {
+	sort.SliceStable(reports, func(i, j int) bool {
+		if reports[i].Header.Month != reports[j].Header.Month {
+			return reports[i].Header.Month > reports[j].Header.Month
+		}
+		return reports[i].CreatedAt.After(reports[j].CreatedAt)
+	})
+}
+
+// issueKeyLess orders by project, then issue number, so ABC-9 comes before
+// ABC-10.
+func issueKeyLess(a string, b string) bool {
+	projectA, numberA := splitIssueKey(a)
+	projectB, numberB := splitIssueKey(b)
+	if projectA != projectB {
+		return projectA < projectB
+	}
+	return numberA < numberB
+}
+
+func splitIssueKey(key string) (string, int) {
+	project, number, _ := strings.Cut(key, "-")
+	n, _ := strconv.Atoi(number)
+	return project, n
+}
+
+// saveReport gives a freshly built report and its entries their ids and
+// stores them.
+func saveReport(ctx context.Context, store Repository, report *Report, author shared.User) error {
+	id, err := newRecordId()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	report.Id = id
+	report.CreatedAt = now
+	report.UpdatedAt = now
+
+	for i := range report.Entries {
+		entry := &report.Entries[i]
+		entry.ReportId = id
+		if err := createEntry(ctx, store, entry, RevisionSourceModel, author); err != nil {
+			return err
+		}
+	}
+	return store.SaveReport(ctx, *report)
+}
+
+// ownedReport loads a report, answering ErrNotFound for someone else's so
+// ids can't be probed.
+func ownedReport(ctx context.Context, store Repository, id string, accountId string) (Report, error) {
+	report, err := store.GetReport(ctx, id)
+	if err != nil {
+		return report, err
+	}
+	if report.AccountId != accountId {
+		return Report{}, ErrNotFound
+	}
+	return report, nil
+}
+
+func writeStoreError(w http.ResponseWriter, log *log.Logger, err error) {
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, "internal server error", http.StatusInternalServerError)
+	log.Println("store error:", err)
+}
+
+func handleCreateReport(log *log.Logger, generator Generator, jiraConfig shared.JiraConfig, httpClient *http.Client, sessions *shared.Sessions, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload ReportRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid JSON payload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		user, _ := shared.UserFromContext(r.Context())
+		period, err := monthPeriod(payload.Month, userLocation(user))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		client, site, err := siteClient(r, jiraConfig, httpClient, sessions)
+		if err != nil {
+			http.Error(w, "Unable to resolve Jira site", http.StatusBadGateway)
+			log.Println("site resolution error:", err)
+			return
+		}
+
+		report, err := BuildReport(r.Context(), log, generator, client, site, user, period)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				log.Println("report cancelled:", err)
+				return
+			}
+			var jiraErr *JiraError
+			if errors.As(err, &jiraErr) && jiraErr.StatusCode == http.StatusUnauthorized {
+				http.Error(w, "Not authorised", http.StatusUnauthorized)
+			} else {
+				http.Error(w, "Error building report", http.StatusBadGateway)
+			}
+			log.Println("report error:", err)
+			return
+		}
+
+		if err := rememberUser(r.Context(), store, user); err != nil {
+			log.Println("unable to store user:", err)
+		}
+		if err := saveReport(r.Context(), store, &report, user); err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		if err := shared.Encode(w, http.StatusCreated, report); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
+
+func handleListReports(log *log.Logger, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := shared.UserFromContext(r.Context())
+		reports, err := store.ListReports(r.Context(), user.AccountId)
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		if err := shared.Encode(w, http.StatusOK, reports); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
+
+// reportRenderer turns a stored report into a downloadable document.
+type reportRenderer struct {
+	extension   string
+	contentType string
+	render      func(Report) ([]byte, error)
+}
+
+const reportJSONType = "application/json"
+
+// reportRenderers are the formats /reports/{id} can be exported as, either by
+// extension (/reports/{id}.pdf or /reports/{id}?format=pdf) or through the
+// Accept header.
+var reportRenderers = []reportRenderer{
+	{extension: "pdf", contentType: "application/pdf", render: renderReportPDF},
+	{extension: "docx", contentType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", render: renderReportDOCX},
+	{extension: "md", contentType: "text/markdown; charset=utf-8", render: renderReportMarkdown},
+	{extension: "csv", contentType: "text/csv; charset=utf-8", render: renderReportCSV},
+	{extension: "xlsx", contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", render: renderReportXLSX},
+}
+
+type acceptRange struct {
+	mediaType string
+	quality   float64
+}
+
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, quality: quality})
+	}
+	return ranges
+}
+
+// acceptQuality is the quality the most specific matching range gives
+// contentType, or 0 when nothing matches.
+func acceptQuality(ranges []acceptRange, contentType string) float64 {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	quality, specificity := 0.0, -1
+	for _, r := range ranges {
+		match := -1
+		switch {
+		case r.mediaType == mediaType:
+			match = 2
+		case strings.HasSuffix(r.mediaType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(r.mediaType, "*")):
+			match = 1
+		case r.mediaType == "*/*":
+			match = 0
+		}
+		if match > specificity {
+			quality, specificity = r.quality, match
+		}
+	}
+	return quality
+}
+
+// negotiateReportFormat picks the renderer named by format, an extension
+// such as "pdf", or else the one the Accept header prefers. ok is false when
+// the format is unknown or nothing on offer is acceptable; a nil renderer
+// means JSON, which also wins ties and wildcards.
+func negotiateReportFormat(format string, header string) (renderer *reportRenderer, ok bool) {
+	switch format {
+	case "":
+	case "json":
+		return nil, true
+	default:
+		for i := range reportRenderers {
+			if reportRenderers[i].extension == format {
+				return &reportRenderers[i], true
+			}
+		}
+		return nil, false
+	}
+
+	if strings.TrimSpace(header) == "" {
+		return nil, true
+	}
+
+	ranges := parseAccept(header)
+	best := acceptQuality(ranges, reportJSONType)
+	for i := range reportRenderers {
+		if quality := acceptQuality(ranges, reportRenderers[i].contentType); quality > best {
+			renderer, best = &reportRenderers[i], quality
+		}
+	}
+	return renderer, best > 0
+}
+
+// reportFilename is what a downloaded report is saved as.
+func reportFilename(report Report, extension string) string {
+	return fmt.Sprintf("creative-report-%s.%s", report.Header.Month, extension)
+}
+
+// cutReportExtension splits a known export extension off a report id, as in
+// "abc.pdf".
+func cutReportExtension(id string) (string, string, bool) {
+	i := strings.LastIndex(id, ".")
+	if i <= 0 {
+		return id, "", false
+	}
+	extension := id[i+1:]
+	if extension == "json" {
+		return id[:i], extension, true
+	}
+	for _, renderer := range reportRenderers {
+		if renderer.extension == extension {
+			return id[:i], extension, true
+		}
+	}
+	return id, "", false
+}
+
+// handleGetReport returns the report as JSON, or exported as a document or
+// spreadsheet when the id carries an extension (/reports/{id}.pdf), ?format=
+// names one (/reports/{id}?format=pdf) or the Accept header asks for one.
+// The id is looked up whole first, so an id containing a dot still works.
+func handleGetReport(log *log.Logger, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		format := r.URL.Query().Get("format")
+
+		user, _ := shared.UserFromContext(r.Context())
+		id := r.PathValue("id")
+		report, err := ownedReport(r.Context(), store, id, user.AccountId)
+		if errors.Is(err, ErrNotFound) {
+			if base, extension, ok := cutReportExtension(id); ok {
+				report, err = ownedReport(r.Context(), store, base, user.AccountId)
+				if format == "" {
+					format = extension
+				}
+			}
+		}
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		renderer, ok := negotiateReportFormat(format, r.Header.Get("Accept"))
+		if !ok {
+			http.Error(w, "Not Acceptable", http.StatusNotAcceptable)
+			return
+		}
+
+		if renderer == nil {
+			if err := shared.Encode(w, http.StatusOK, report); err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				log.Println(err)
+			}
+			return
+		}
+
+		document, err := renderer.render(report)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Printf("render %s report error: %v\n", renderer.extension, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", renderer.contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", reportFilename(report, renderer.extension)))
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(document); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func handleDeleteReport(log *log.Logger, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := shared.UserFromContext(r.Context())
+		report, err := ownedReport(r.Context(), store, r.PathValue("id"), user.AccountId)
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		if err := store.DeleteReport(r.Context(), report.Id); err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"JiraConnect/shared"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateReportFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		accept string
+		want   string
+		ok     bool
+	}{
+		{name: "nothing asked for", want: "json", ok: true},
+		{name: "format", format: "pdf", want: "pdf", ok: true},
+		{name: "format beats accept", format: "xlsx", accept: "application/pdf", want: "xlsx", ok: true},
+		{name: "json format", format: "json", accept: "application/pdf", want: "json", ok: true},
+		{name: "unknown format", format: "exe", ok: false},
+		{name: "accept", accept: "application/pdf", want: "pdf", ok: true},
+		{name: "accept with parameters", accept: "text/markdown; charset=utf-8", want: "md", ok: true},
+		{name: "quality", accept: "application/pdf;q=0.5, text/csv", want: "csv", ok: true},
+		{name: "json wins ties", accept: "application/pdf, application/json", want: "json", ok: true},
+		{name: "wildcard", accept: "*/*", want: "json", ok: true},
+		{name: "type wildcard", accept: "text/*;q=0.9, application/json;q=0.1", want: "md", ok: true},
+		{name: "nothing acceptable", accept: "image/png", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer, ok := negotiateReportFormat(tt.format, tt.accept)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			got := "json"
+			if renderer != nil {
+				got = renderer.extension
+			}
+			if got != tt.want {
+				t.Errorf("format = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleGetReport(t *testing.T) {
+	store := NewMemoryRepository()
+	report := testReport()
+	// Ids are only opaque strings; a dot must not be read as an extension.
+	report.Id = "report.v2"
+	if err := store.SaveReport(t.Context(), report); err != nil {
+		t.Fatal(err)
+	}
+	plain := testReport()
+	if err := store.SaveReport(t.Context(), plain); err != nil {
+		t.Fatal(err)
+	}
+	handler := handleGetReport(log.New(io.Discard, "", 0), store)
+
+	get := func(id string, query string, accept string, accountId string) *http.Response {
+		r := httptest.NewRequest(http.MethodGet, "/reports/"+id+query, nil)
+		r.SetPathValue("id", id)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		r = r.WithContext(shared.WithUser(r.Context(), shared.User{AccountId: accountId}))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Result()
+	}
+
+	tests := []struct {
+		name        string
+		id          string
+		query       string
+		accept      string
+		accountId   string
+		status      int
+		contentType string
+	}{
+		{name: "json", id: report.Id, accountId: "me", status: http.StatusOK, contentType: "application/json"},
+		{name: "format query", id: report.Id, query: "?format=pdf", accountId: "me", status: http.StatusOK, contentType: "application/pdf"},
+		{name: "accept header", id: report.Id, accept: "text/csv", accountId: "me", status: http.StatusOK, contentType: "text/csv; charset=utf-8"},
+		{name: "unknown format", id: report.Id, query: "?format=exe", accountId: "me", status: http.StatusNotAcceptable},
+		{name: "someone else's report", id: report.Id, query: "?format=pdf", accountId: "other", status: http.StatusNotFound},
+		{name: "missing", id: "other", accountId: "me", status: http.StatusNotFound},
+		{name: "pdf suffix", id: plain.Id + ".pdf", accountId: "me", status: http.StatusOK, contentType: "application/pdf"},
+		{name: "docx suffix", id: plain.Id + ".docx", accountId: "me", status: http.StatusOK, contentType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{name: "md suffix", id: plain.Id + ".md", accountId: "me", status: http.StatusOK, contentType: "text/markdown; charset=utf-8"},
+		{name: "json suffix", id: plain.Id + ".json", accept: "application/pdf", accountId: "me", status: http.StatusOK, contentType: "application/json"},
+		{name: "suffix on a dotted id", id: report.Id + ".xlsx", accountId: "me", status: http.StatusOK, contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		{name: "format query beats suffix", id: plain.Id + ".pdf", query: "?format=csv", accountId: "me", status: http.StatusOK, contentType: "text/csv; charset=utf-8"},
+		{name: "unknown suffix", id: plain.Id + ".exe", accountId: "me", status: http.StatusNotFound},
+		{name: "suffix on someone else's report", id: plain.Id + ".pdf", accountId: "other", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := get(tt.id, tt.query, tt.accept, tt.accountId)
+			if res.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+			if tt.contentType != "" && res.Header.Get("Content-Type") != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", res.Header.Get("Content-Type"), tt.contentType)
+			}
+		})
+	}
+}
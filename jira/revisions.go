@@ -0,0 +1,386 @@
+package main
+
+import (
+	"JiraConnect/shared"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RevisionSourceModel   = "model"
+	RevisionSourceHuman   = "human"
+	RevisionSourceRestore = "restore"
+
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+
+	// diffCellLimit bounds the LCS table; longer texts are shown as replaced
+	// outright rather than diffed word by word.
+	diffCellLimit = 4_000_000
+
+	// reviseAttempts bounds how often a change with no base revision is
+	// retried after losing a race to another save.
+	reviseAttempts = 3
+)
+
+var ErrRevisionConflict = errors.New("entry was changed by another revision")
+
+// Revision is a snapshot of an entry's text, recording whether it came from
+// the model or a person, so a reviewer can see what was changed by hand.
+type Revision struct {
+	EntryId       string    `json:"entryId"`
+	Number        int       `json:"number"`
+	Source        string    `json:"source"`
+	AuthorId      string    `json:"authorId"`
+	AuthorName    string    `json:"authorName"`
+	Heading       string    `json:"heading"`
+	Description   string    `json:"description"`
+	Links         []string  `json:"links"`
+	Hours         float64   `json:"hours"`
+	PromptVersion string    `json:"promptVersion,omitempty"`
+	RestoredFrom  int       `json:"restoredFrom,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type DiffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type FieldDiff struct {
+	Field   string   `json:"field"`
+	Changed bool     `json:"changed"`
+	Ops     []DiffOp `json:"ops"`
+}
+
+type RevisionDiff struct {
+	From   int         `json:"from"`
+	To     int         `json:"to"`
+	Fields []FieldDiff `json:"fields"`
+}
+
+func snapshot(entry Entry, source string, author shared.User) Revision {
+	revision := Revision{
+		EntryId:     entry.Id,
+		Number:      entry.Revision,
+		Source:      source,
+		AuthorId:    author.AccountId,
+		AuthorName:  author.Name,
+		Heading:     entry.Heading,
+		Description: entry.Description,
+		Links:       entry.Links,
+		Hours:       entry.Hours,
+		CreatedAt:   entry.UpdatedAt,
+	}
+	if source == RevisionSourceModel {
+		revision.PromptVersion = entry.PromptVersion
+	}
+	return revision
+}
+
+// reviseEntry copies revision's text onto the entry as its next revision.
+// base, when not zero, is the revision the change was made against; if the
+// entry has moved on since, nothing is saved and ErrRevisionConflict is
+// returned. The repository makes the revision bump itself, so two saves
+// can't both claim the same number. Once the revision is saved it is
+// returned as a success, even if the report's totals couldn't be refreshed:
+// failing then would only have the client save the revision again.
+func reviseEntry(ctx context.Context, log *log.Logger, store Repository, entry Entry, base int, author shared.User, revision Revision) (Entry, error) {
+	for attempt := 1; ; attempt++ {
+		current, err := store.GetEntry(ctx, entry.Id)
+		if err != nil {
+			return entry, err
+		}
+		if base != 0 && base != current.Revision {
+			return current, ErrRevisionConflict
+		}
+
+		current.Heading = revision.Heading
+		current.Description = revision.Description
+		current.Links = revision.Links
+		current.Hours = revision.Hours
+		// Someone writing the text by hand fixes a failed generation.
+		current.Error = ""
+		current.Revision++
+		current.Source = revision.Source
+		current.UpdatedAt = time.Now().UTC()
+
+		next := snapshot(current, revision.Source, author)
+		next.RestoredFrom = revision.RestoredFrom
+		err = store.ReviseEntry(ctx, current, next)
+		if errors.Is(err, ErrRevisionConflict) && base == 0 && attempt < reviseAttempts {
+			continue
+		}
+		if err != nil {
+			return current, err
+		}
+		if err := refreshReport(ctx, store, current.ReportId); err != nil {
+			log.Printf("entry %s revision %d saved but report %s not refreshed: %v\n", current.Id, current.Revision, current.ReportId, err)
+		}
+		return current, nil
+	}
+}
+
+func findRevision(revisions []Revision, number int) (Revision, bool) {
+	for _, revision := range revisions {
+		if revision.Number == number {
+			return revision, true
+		}
+	}
+	return Revision{}, false
+}
+
+func diffRevisions(from Revision, to Revision) RevisionDiff {
+	fields := []struct {
+		name string
+		a, b string
+	}{
+		{"heading", from.Heading, to.Heading},
+		{"description", from.Description, to.Description},
+		{"links", strings.Join(from.Links, "\n"), strings.Join(to.Links, "\n")},
+		{"hours", strconv.FormatFloat(from.Hours, 'f', -1, 64), strconv.FormatFloat(to.Hours, 'f', -1, 64)},
+	}
+
+	diff := RevisionDiff{From: from.Number, To: to.Number}
+	for _, field := range fields {
+		diff.Fields = append(diff.Fields, FieldDiff{
+			Field:   field.name,
+			Changed: field.a != field.b,
+			Ops:     diffText(field.a, field.b),
+		})
+	}
+	return diff
+}
+
+var diffTokenPattern = regexp.MustCompile(`\s+|[^\s]+`)
+
+// diffText is a word-level diff of a against b, built from their longest
+// common subsequence.
+func diffText(a string, b string) []DiffOp {
+	if a == b {
+		if a == "" {
+			return []DiffOp{}
+		}
+		return []DiffOp{{Op: DiffEqual, Text: a}}
+	}
+
+	from := diffTokenPattern.FindAllString(a, -1)
+	to := diffTokenPattern.FindAllString(b, -1)
+	if (len(from)+1)*(len(to)+1) > diffCellLimit {
+		return appendOps(appendOps(nil, DiffDelete, a), DiffInsert, b)
+	}
+
+	// lcs[i][j] is the common subsequence length of from[i:] and to[j:].
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []DiffOp
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i] == to[j]:
+			ops = appendOps(ops, DiffEqual, from[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = appendOps(ops, DiffDelete, from[i])
+			i++
+		default:
+			ops = appendOps(ops, DiffInsert, to[j])
+			j++
+		}
+	}
+	for ; i < len(from); i++ {
+		ops = appendOps(ops, DiffDelete, from[i])
+	}
+	for ; j < len(to); j++ {
+		ops = appendOps(ops, DiffInsert, to[j])
+	}
+	return ops
+}
+
+// appendOps merges runs of the same operation into one.
+func appendOps(ops []DiffOp, op string, text string) []DiffOp {
+	if text == "" {
+		return ops
+	}
+	if n := len(ops); n > 0 && ops[n-1].Op == op {
+		ops[n-1].Text += text
+		return ops
+	}
+	return append(ops, DiffOp{Op: op, Text: text})
+}
+
+func writeRevisionError(w http.ResponseWriter, log *log.Logger, err error) {
+	if errors.Is(err, ErrRevisionConflict) {
+		http.Error(w, "Entry has a newer revision, reload and try again", http.StatusConflict)
+		return
+	}
+	writeStoreError(w, log, err)
+}
+
+// handleUpdateEntry saves a person's edit as a new revision.
+func handleUpdateEntry(log *log.Logger, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload EntryPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid JSON payload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		user, _ := shared.UserFromContext(r.Context())
+		entry, err := ownedEntry(r.Context(), store, r.PathValue("id"), user.AccountId)
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		links := payload.Links
+		if links == nil {
+			links = []string{}
+		}
+		entry, err = reviseEntry(r.Context(), log, store, entry, payload.Revision, user, Revision{
+			Source:      RevisionSourceHuman,
+			Heading:     payload.Heading,
+			Description: payload.Description,
+			Links:       links,
+			Hours:       payload.Hours,
+		})
+		if err != nil {
+			writeRevisionError(w, log, err)
+			return
+		}
+
+		if err := shared.Encode(w, http.StatusOK, entry); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
+
+func handleListRevisions(log *log.Logger, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := shared.UserFromContext(r.Context())
+		entry, err := ownedEntry(r.Context(), store, r.PathValue("id"), user.AccountId)
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		revisions, err := store.ListRevisions(r.Context(), entry.Id)
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		if err := shared.Encode(w, http.StatusOK, revisions); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
+
+// handleDiffRevisions compares two revisions, by default the first (usually
+// the model's output) against the current one.
+func handleDiffRevisions(log *log.Logger, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := shared.UserFromContext(r.Context())
+		entry, err := ownedEntry(r.Context(), store, r.PathValue("id"), user.AccountId)
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		revisions, err := store.ListRevisions(r.Context(), entry.Id)
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		params := r.URL.Query()
+		numbers := [2]int{1, entry.Revision}
+		for i, name := range []string{"from", "to"} {
+			if raw := params.Get(name); raw != "" {
+				if numbers[i], err = strconv.Atoi(raw); err != nil {
+					http.Error(w, fmt.Sprintf("invalid %s revision %q", name, raw), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		from, okFrom := findRevision(revisions, numbers[0])
+		to, okTo := findRevision(revisions, numbers[1])
+		if !okFrom || !okTo {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		if err := shared.Encode(w, http.StatusOK, diffRevisions(from, to)); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
+
+// handleRestoreRevision copies an earlier revision forward as the newest one,
+// so history is never rewritten.
+func handleRestoreRevision(log *log.Logger, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		number, err := strconv.Atoi(r.PathValue("number"))
+		if err != nil {
+			http.Error(w, "invalid revision number", http.StatusBadRequest)
+			return
+		}
+
+		user, _ := shared.UserFromContext(r.Context())
+		entry, err := ownedEntry(r.Context(), store, r.PathValue("id"), user.AccountId)
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+
+		revisions, err := store.ListRevisions(r.Context(), entry.Id)
+		if err != nil {
+			writeStoreError(w, log, err)
+			return
+		}
+		revision, ok := findRevision(revisions, number)
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		revision.Source = RevisionSourceRestore
+		revision.RestoredFrom = number
+		entry, err = reviseEntry(r.Context(), log, store, entry, 0, user, revision)
+		if err != nil {
+			writeRevisionError(w, log, err)
+			return
+		}
+
+		if err := shared.Encode(w, http.StatusOK, entry); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
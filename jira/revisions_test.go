@@ -0,0 +1,174 @@
+package main
+
+import (
+	"JiraConnect/shared"
+	"errors"
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDiffText(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []DiffOp
+	}{
+		{name: "both empty", want: []DiffOp{}},
+		{name: "unchanged", a: "same text", b: "same text", want: []DiffOp{{DiffEqual, "same text"}}},
+		{name: "added", b: "new", want: []DiffOp{{DiffInsert, "new"}}},
+		{name: "removed", a: "old", want: []DiffOp{{DiffDelete, "old"}}},
+		{
+			name: "word replaced",
+			a:    "fixed the login bug",
+			b:    "fixed the signup bug",
+			want: []DiffOp{{DiffEqual, "fixed the "}, {DiffDelete, "login"}, {DiffInsert, "signup"}, {DiffEqual, " bug"}},
+		},
+		{
+			name: "words appended",
+			a:    "wrote tests",
+			b:    "wrote tests and docs",
+			want: []DiffOp{{DiffEqual, "wrote tests"}, {DiffInsert, " and docs"}},
+		},
+		{
+			name: "whitespace is a change",
+			a:    "one two",
+			b:    "one\ntwo",
+			want: []DiffOp{{DiffEqual, "one"}, {DiffDelete, " "}, {DiffInsert, "\n"}, {DiffEqual, "two"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffText(tt.a, tt.b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffText() = %+v, want %+v", got, tt.want)
+			}
+
+			// Equal and deleted text rebuild a, equal and inserted text rebuild b.
+			var from, to strings.Builder
+			for _, op := range got {
+				if op.Op != DiffInsert {
+					from.WriteString(op.Text)
+				}
+				if op.Op != DiffDelete {
+					to.WriteString(op.Text)
+				}
+			}
+			if from.String() != tt.a || to.String() != tt.b {
+				t.Errorf("ops rebuild %q -> %q, want %q -> %q", from.String(), to.String(), tt.a, tt.b)
+			}
+		})
+	}
+}
+
+func TestDiffTextTooLarge(t *testing.T) {
+	a := strings.Repeat("a ", 2000)
+	b := strings.Repeat("b ", 2000)
+	want := []DiffOp{{DiffDelete, a}, {DiffInsert, b}}
+	if got := diffText(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffText() returned %d ops, want a single delete and insert", len(got))
+	}
+}
+
+func TestReviseEntryConflict(t *testing.T) {
+	store := NewMemoryRepository()
+	logger := log.New(io.Discard, "", 0)
+	author := shared.User{AccountId: "me"}
+	entry := Entry{AccountId: "me", Heading: "first"}
+	if err := createEntry(t.Context(), store, &entry, RevisionSourceModel, author); err != nil {
+		t.Fatal(err)
+	}
+
+	edited, err := reviseEntry(t.Context(), logger, store, entry, 1, author, Revision{Source: RevisionSourceHuman, Heading: "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited.Revision != 2 || edited.Heading != "second" {
+		t.Fatalf("edited = revision %d %q, want revision 2 %q", edited.Revision, edited.Heading, "second")
+	}
+
+	// A save made against revision 1 must not overwrite revision 2.
+	if _, err := reviseEntry(t.Context(), logger, store, entry, 1, author, Revision{Source: RevisionSourceHuman, Heading: "stale"}); !errors.Is(err, ErrRevisionConflict) {
+		t.Fatalf("stale save error = %v, want ErrRevisionConflict", err)
+	}
+	if stored, _ := store.GetEntry(t.Context(), entry.Id); stored.Heading != "second" {
+		t.Errorf("stored heading = %q after a stale save", stored.Heading)
+	}
+}
+
+func TestReviseEntryKeepsRevisionWhenReportRefreshFails(t *testing.T) {
+	store := NewMemoryRepository()
+	logger := log.New(io.Discard, "", 0)
+	author := shared.User{AccountId: "me"}
+	// The report is gone, so its totals can't be refreshed.
+	entry := Entry{AccountId: "me", ReportId: "deleted", Heading: "first"}
+	if err := createEntry(t.Context(), store, &entry, RevisionSourceModel, author); err != nil {
+		t.Fatal(err)
+	}
+
+	edited, err := reviseEntry(t.Context(), logger, store, entry, 1, author, Revision{Source: RevisionSourceHuman, Heading: "second"})
+	if err != nil {
+		t.Fatalf("reviseEntry() = %v, want the saved revision", err)
+	}
+	if edited.Revision != 2 {
+		t.Errorf("edited revision = %d, want 2", edited.Revision)
+	}
+	revisions, err := store.ListRevisions(t.Context(), entry.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 {
+		t.Errorf("%d revisions stored, want 2", len(revisions))
+	}
+}
+
+func TestReviseEntryConcurrent(t *testing.T) {
+	store := NewMemoryRepository()
+	logger := log.New(io.Discard, "", 0)
+	author := shared.User{AccountId: "me"}
+	entry := Entry{AccountId: "me", Heading: "first"}
+	if err := createEntry(t.Context(), store, &entry, RevisionSourceModel, author); err != nil {
+		t.Fatal(err)
+	}
+
+	const saves = 8
+	var wg sync.WaitGroup
+	results := make([]error, saves)
+	for i := range saves {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, results[i] = reviseEntry(t.Context(), logger, store, entry, 1, author, Revision{Source: RevisionSourceHuman, Heading: "edit"})
+		}()
+	}
+	wg.Wait()
+
+	saved := 0
+	for _, err := range results {
+		switch {
+		case err == nil:
+			saved++
+		case !errors.Is(err, ErrRevisionConflict):
+			t.Fatal(err)
+		}
+	}
+	if saved != 1 {
+		t.Errorf("%d saves against revision 1 succeeded, want exactly 1", saved)
+	}
+
+	revisions, err := store.ListRevisions(t.Context(), entry.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, revision := range revisions {
+		if revision.Number != i+1 {
+			t.Fatalf("revision numbers = %+v, want 1 and 2", revisions)
+		}
+	}
+	if len(revisions) != 2 {
+		t.Errorf("got %d revisions, want 2", len(revisions))
+	}
+}
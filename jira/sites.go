@@ -0,0 +1,179 @@
+package main
+
+import (
+	"JiraConnect/shared"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+var errNoSite = errors.New("no accessible jira site for this token")
+
+type SiteList struct {
+	Sites    []shared.Site `json:"sites"`
+	Selected string        `json:"selected"`
+}
+
+type SiteSelection struct {
+	CloudId string `json:"cloudId"`
+}
+
+// requestedCloudId reads the site a caller wants to target, preferring an
+// explicit query parameter over the one remembered in the session.
+func requestedCloudId(r *http.Request) string {
+	if cloudId := r.URL.Query().Get("cloudId"); cloudId != "" {
+		return cloudId
+	}
+	session, _ := shared.SessionFromContext(r.Context())
+	return session.CloudId
+}
+
+// listSites returns the sites the session can reach. An API token is bound to
+// the single site it was registered against.
+func listSites(ctx context.Context, httpClient *http.Client) ([]shared.Site, error) {
+	session, _ := shared.SessionFromContext(ctx)
+	if session.ApiToken != nil {
+		return []shared.Site{session.ApiToken.Site()}, nil
+	}
+	return shared.GetAccessibleResources(ctx, httpClient, session.Token.AccessToken)
+}
+
+// resolveSite finds the site the caller targets. The session's own site comes
+// from its cache once resolved; any other site is looked up every time.
+func resolveSite(ctx context.Context, r *http.Request, httpClient *http.Client, sessions *shared.Sessions) (shared.Site, error) {
+	session, _ := shared.SessionFromContext(ctx)
+	cloudId := requestedCloudId(r)
+	if session.ApiToken == nil && session.Site != nil && cloudId == session.CloudId {
+		return *session.Site, nil
+	}
+
+	sites, err := listSites(ctx, httpClient)
+	if err != nil {
+		return shared.Site{}, err
+	}
+	site, ok := shared.FindSite(sites, cloudId)
+	if !ok {
+		return shared.Site{}, errNoSite
+	}
+
+	// A failed save only costs the next request another lookup.
+	if session.ApiToken == nil && cloudId == session.CloudId {
+		_, _ = sessions.Update(ctx, session.Id, func(stored *shared.Session) {
+			if stored.CloudId == cloudId {
+				stored.Site = &site
+			}
+		})
+	}
+	return site, nil
+}
+
+// jiraBaseUrl routes OAuth calls through the api.atlassian.com gateway. API
+// tokens are only accepted by the site itself, so Basic auth goes direct.
+func jiraBaseUrl(config shared.JiraConfig, site shared.Site, session shared.Session) string {
+	if session.ApiToken != nil {
+		return site.Url
+	}
+	return config.ApiUrl + "/ex/jira/" + site.Id
+}
+
+// siteClient resolves the caller's Jira site and builds a client scoped to it,
+// authorised with whichever credential the session carries.
+func siteClient(r *http.Request, config shared.JiraConfig, httpClient *http.Client, sessions *shared.Sessions) (*JiraClient, shared.Site, error) {
+	site, err := resolveSite(r.Context(), r, httpClient, sessions)
+	if err != nil {
+		return nil, site, err
+	}
+	session, _ := shared.SessionFromContext(r.Context())
+	return NewJiraClient(httpClient, jiraBaseUrl(config, site, session), session.Authorization()), site, nil
+}
+
+// rememberSite keeps the session's current site when it is still reachable and
+// otherwise falls back to the first site the token can see.
+func rememberSite(ctx context.Context, log *log.Logger, httpClient *http.Client, sessions *shared.Sessions, session *shared.Session) {
+	sites, err := shared.GetAccessibleResources(ctx, httpClient, session.Token.AccessToken)
+	if err != nil {
+		log.Println("unable to discover jira sites:", err)
+		return
+	}
+
+	site, ok := shared.FindSite(sites, session.CloudId)
+	if !ok {
+		site, ok = shared.FindSite(sites, "")
+	}
+	if !ok {
+		return
+	}
+
+	updated, err := sessions.Update(ctx, session.Id, func(session *shared.Session) {
+		session.CloudId = site.Id
+		session.Site = &site
+	})
+	if err != nil {
+		log.Println("unable to save jira site:", err)
+		return
+	}
+	*session = updated
+}
+
+func handleListSites(log *log.Logger, httpClient *http.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sites, err := listSites(r.Context(), httpClient)
+		if err != nil {
+			http.Error(w, "Error retrieving sites", http.StatusBadGateway)
+			log.Println("accessible-resources error:", err)
+			return
+		}
+
+		list := SiteList{Sites: sites}
+		if site, ok := shared.FindSite(sites, requestedCloudId(r)); ok {
+			list.Selected = site.Id
+		} else if site, ok := shared.FindSite(sites, ""); ok {
+			list.Selected = site.Id
+		}
+
+		if err := shared.Encode(w, http.StatusOK, list); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
+
+func handleSelectSite(log *log.Logger, httpClient *http.Client, sessions *shared.Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var selection SiteSelection
+		if err := json.NewDecoder(r.Body).Decode(&selection); err != nil || selection.CloudId == "" {
+			http.Error(w, "cloudId is required", http.StatusBadRequest)
+			return
+		}
+
+		session, _ := shared.SessionFromContext(r.Context())
+		sites, err := listSites(r.Context(), httpClient)
+		if err != nil {
+			http.Error(w, "Error retrieving sites", http.StatusBadGateway)
+			log.Println("accessible-resources error:", err)
+			return
+		}
+		site, ok := shared.FindSite(sites, selection.CloudId)
+		if !ok {
+			http.Error(w, errNoSite.Error(), http.StatusNotFound)
+			return
+		}
+
+		session, err = sessions.Update(r.Context(), session.Id, func(stored *shared.Session) {
+			stored.CloudId = site.Id
+			stored.Site = &site
+		})
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println("unable to save jira site:", err)
+			return
+		}
+
+		if err := shared.Encode(w, http.StatusOK, session.Info()); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"JiraConnect/shared"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// accessibleResourcesClient answers every request with the given sites and
+// counts the calls.
+func accessibleResourcesClient(calls *int, body string) *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		*calls++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})}
+}
+
+func TestResolveSiteCachesSessionSite(t *testing.T) {
+	store := shared.NewMemorySessionStore()
+	sessions := shared.NewSessions(store, nil)
+	session := shared.Session{Id: "session", CloudId: "cloud-b", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := store.Save(t.Context(), session); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	httpClient := accessibleResourcesClient(&calls, `[{"id":"cloud-a","url":"https://a.atlassian.net"},{"id":"cloud-b","url":"https://b.atlassian.net"}]`)
+
+	resolve := func(target string, session shared.Session) shared.Site {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r = r.WithContext(shared.WithSession(r.Context(), session))
+		site, err := resolveSite(r.Context(), r, httpClient, sessions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return site
+	}
+
+	if site := resolve("/issues", session); site.Id != "cloud-b" || calls != 1 {
+		t.Fatalf("first lookup = %q after %d calls, want cloud-b after 1", site.Id, calls)
+	}
+
+	cached, err := store.Get(t.Context(), session.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.Site == nil || cached.Site.Url != "https://b.atlassian.net" {
+		t.Fatalf("cached site = %+v", cached.Site)
+	}
+
+	if site := resolve("/issues", cached); site.Id != "cloud-b" || calls != 1 {
+		t.Errorf("cached lookup = %q after %d calls, want cloud-b without a call", site.Id, calls)
+	}
+
+	// Another site is a miss and must not replace the session's own.
+	if site := resolve("/issues?cloudId=cloud-a", cached); site.Id != "cloud-a" || calls != 2 {
+		t.Errorf("override lookup = %q after %d calls, want cloud-a after 2", site.Id, calls)
+	}
+	cached, _ = store.Get(t.Context(), session.Id)
+	if cached.Site == nil || cached.Site.Id != "cloud-b" {
+		t.Errorf("cached site after override = %+v, want cloud-b", cached.Site)
+	}
+}
+
+func TestResolveSiteApiTokenSkipsCache(t *testing.T) {
+	session := shared.Session{
+		Id:       "session",
+		ApiToken: &shared.ApiToken{Email: "a@example.com", Token: "token", SiteUrl: "https://token.atlassian.net"},
+		Site:     &shared.Site{Id: "cloud-a", Url: "https://a.atlassian.net"},
+	}
+
+	calls := 0
+	r := httptest.NewRequest(http.MethodGet, "/issues", nil)
+	r = r.WithContext(shared.WithSession(r.Context(), session))
+	site, err := resolveSite(r.Context(), r, accessibleResourcesClient(&calls, `[]`), shared.NewSessions(shared.NewMemorySessionStore(), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if site.Url != "https://token.atlassian.net" || calls != 0 {
+		t.Errorf("site = %+v after %d calls, want the token's site without a call", site, calls)
+	}
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"JiraConnect/shared"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("record not found")
+
+// Repository stores what the service generates so a month's work outlives the
+// browser tab it was generated in.
+type Repository interface {
+	SaveUser(ctx context.Context, user StoredUser) error
+	GetUser(ctx context.Context, accountId string) (StoredUser, error)
+
+	SaveReport(ctx context.Context, report Report) error
+	GetReport(ctx context.Context, id string) (Report, error)
+	ListReports(ctx context.Context, accountId string) ([]Report, error)
+	DeleteReport(ctx context.Context, id string) error
+
+	SaveEntry(ctx context.Context, entry Entry) error
+	GetEntry(ctx context.Context, id string) (Entry, error)
+	ListEntries(ctx context.Context, filter EntryFilter) ([]Entry, error)
+	DeleteEntry(ctx context.Context, id string) error
+
+	SaveRevision(ctx context.Context, revision Revision) error
+	ListRevisions(ctx context.Context, entryId string) ([]Revision, error)
+	// ReviseEntry saves entry along with its new revision, but only while the
+	// stored entry is still at the revision before it. Otherwise nothing is
+	// saved and ErrRevisionConflict is returned.
+	ReviseEntry(ctx context.Context, entry Entry, revision Revision) error
+
+	SaveJob(ctx context.Context, job Job) error
+	GetJob(ctx context.Context, id string) (Job, error)
+	ListJobs(ctx context.Context, accountId string) ([]Job, error)
+}
+
+type StoreConfig struct {
+	Store string
+	Path  string
+}
+
+func NewRepository(config StoreConfig) (Repository, error) {
+	switch config.Store {
+	case "memory":
+		return NewMemoryRepository(), nil
+	case "", "file":
+		return NewFileRepository(config.Path)
+	default:
+		return nil, fmt.Errorf("unknown data store %q", config.Store)
+	}
+}
+
+type StoredUser struct {
+	AccountId string    `json:"accountId"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	TimeZone  string    `json:"timeZone,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// EntryFilter narrows ListEntries. Empty fields match everything.
+type EntryFilter struct {
+	AccountId string
+	ReportId  string
+	Key       string
+}
+
+func (f EntryFilter) matches(entry Entry) bool {
+	return (f.AccountId == "" || entry.AccountId == f.AccountId) &&
+		(f.ReportId == "" || entry.ReportId == f.ReportId) &&
+		(f.Key == "" || entry.Key == f.Key)
+}
+
+func newRecordId() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate record id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// rememberUser records the caller, keeping when they were first seen.
+func rememberUser(ctx context.Context, store Repository, user shared.User) error {
+	now := time.Now().UTC()
+	stored, err := store.GetUser(ctx, user.AccountId)
+	if errors.Is(err, ErrNotFound) {
+		stored = StoredUser{AccountId: user.AccountId, CreatedAt: now}
+	} else if err != nil {
+		return err
+	}
+
+	stored.Name = user.Name
+	stored.Email = user.Email
+	stored.TimeZone = user.TimeZone
+	stored.UpdatedAt = now
+	return store.SaveUser(ctx, stored)
+}
+
+type repositoryData struct {
+	Users     map[string]StoredUser `json:"users"`
+	Reports   map[string]Report     `json:"reports"`
+	Entries   map[string]Entry      `json:"entries"`
+	Revisions map[string][]Revision `json:"revisions"`
+	Jobs      map[string]Job        `json:"jobs"`
+}
+
+type MemoryRepository struct {
+	mu   sync.RWMutex
+	data repositoryData
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{data: repositoryData{
+		Users:     make(map[string]StoredUser),
+		Reports:   make(map[string]Report),
+		Entries:   make(map[string]Entry),
+		Revisions: make(map[string][]Revision),
+		Jobs:      make(map[string]Job),
+	}}
+}
+
+func (s *MemoryRepository) SaveUser(_ context.Context, user StoredUser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Users[user.AccountId] = user
+	return nil
+}
+
+func (s *MemoryRepository) GetUser(_ context.Context, accountId string) (StoredUser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.data.Users[accountId]
+	if !ok {
+		return StoredUser{}, ErrNotFound
+	}
+	return user, nil
+}
+
+// SaveReport stores the report's header and totals. Its entries are saved on
+// their own so they can be edited without rewriting the report.
+func (s *MemoryRepository) SaveReport(_ context.Context, report Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report.Entries = nil
+	s.data.Reports[report.Id] = report
+	return nil
+}
+
+func (s *MemoryRepository) GetReport(_ context.Context, id string) (Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	report, ok := s.data.Reports[id]
+	if !ok {
+		return Report{}, ErrNotFound
+	}
+	report.Entries = s.entries(EntryFilter{ReportId: id})
+	return report, nil
+}
+
+func (s *MemoryRepository) ListReports(_ context.Context, accountId string) ([]Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reports := []Report{}
+	for _, report := range s.data.Reports {
+		if report.AccountId == accountId {
+			report.Entries = s.entries(EntryFilter{ReportId: report.Id})
+			reports = append(reports, report)
+		}
+	}
+	sortReports(reports)
+	return reports, nil
+}
+
+// DeleteReport removes the report along with its entries.
+func (s *MemoryRepository) DeleteReport(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteReport(id)
+}
+
+func (s *MemoryRepository) deleteReport(id string) error {
+	if _, ok := s.data.Reports[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.data.Reports, id)
+	for entryId, entry := range s.data.Entries {
+		if entry.ReportId == id {
+			s.deleteEntry(entryId)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryRepository) SaveEntry(_ context.Context, entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Entries[entry.Id] = entry
+	return nil
+}
+
+func (s *MemoryRepository) GetEntry(_ context.Context, id string) (Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.data.Entries[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	return entry, nil
+}
+
+func (s *MemoryRepository) ListEntries(_ context.Context, filter EntryFilter) ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.entries(filter), nil
+}
+
+func (s *MemoryRepository) DeleteEntry(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data.Entries[id]; !ok {
+		return ErrNotFound
+	}
+	s.deleteEntry(id)
+	return nil
+}
+
+// deleteEntry must be called with the lock held.
+func (s *MemoryRepository) deleteEntry(id string) {
+	delete(s.data.Entries, id)
+	delete(s.data.Revisions, id)
+}
+
+func (s *MemoryRepository) SaveRevision(_ context.Context, revision Revision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Revisions[revision.EntryId] = append(s.data.Revisions[revision.EntryId], revision)
+	return nil
+}
+
+func (s *MemoryRepository) ReviseEntry(_ context.Context, entry Entry, revision Revision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reviseEntry(entry, revision)
+}
+
+// reviseEntry must be called with the lock held.
+func (s *MemoryRepository) reviseEntry(entry Entry, revision Revision) error {
+	current, ok := s.data.Entries[entry.Id]
+	if !ok {
+		return ErrNotFound
+	}
+	if current.Revision != entry.Revision-1 {
+		return ErrRevisionConflict
+	}
+
+	s.data.Entries[entry.Id] = entry
+	s.data.Revisions[entry.Id] = append(s.data.Revisions[entry.Id], revision)
+	return nil
+}
+
+// ListRevisions returns an entry's revisions oldest first.
+func (s *MemoryRepository) ListRevisions(_ context.Context, entryId string) ([]Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]Revision{}, s.data.Revisions[entryId]...), nil
+}
+
+func (s *MemoryRepository) SaveJob(_ context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Jobs[job.Id] = job
+	return nil
+}
+
+func (s *MemoryRepository) GetJob(_ context.Context, id string) (Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.data.Jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return job, nil
+}
+
+// ListJobs returns the account's jobs oldest first, or everyone's when
+// accountId is empty.
+func (s *MemoryRepository) ListJobs(_ context.Context, accountId string) ([]Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := []Job{}
+	for _, job := range s.data.Jobs {
+		if accountId == "" || job.AccountId == accountId {
+			jobs = append(jobs, job)
+		}
+	}
+	sortJobs(jobs)
+	return jobs, nil
+}
+
+// entries must be called with the lock held.
+func (s *MemoryRepository) entries(filter EntryFilter) []Entry {
+	entries := []Entry{}
+	for _, entry := range s.data.Entries {
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	sortEntries(entries)
+	return entries
+}
+
+// FileRepository keeps everything in memory and rewrites a JSON file on every
+// change, the same way FileSessionStore does for sessions.
+type FileRepository struct {
+	MemoryRepository
+	path string
+}
+
+func NewFileRepository(path string) (*FileRepository, error) {
+	if path == "" {
+		return nil, errors.New("file data store requires a path")
+	}
+
+	store := &FileRepository{
+		MemoryRepository: *NewMemoryRepository(),
+		path:             path,
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read data file: %w", err)
+	}
+	if err := json.Unmarshal(raw, &store.data); err != nil {
+		return nil, fmt.Errorf("decode data file: %w", err)
+	}
+
+	// Older files may be missing a collection entirely.
+	if store.data.Users == nil {
+		store.data.Users = make(map[string]StoredUser)
+	}
+	if store.data.Reports == nil {
+		store.data.Reports = make(map[string]Report)
+	}
+	if store.data.Entries == nil {
+		store.data.Entries = make(map[string]Entry)
+	}
+	if store.data.Revisions == nil {
+		store.data.Revisions = make(map[string][]Revision)
+	}
+	if store.data.Jobs == nil {
+		store.data.Jobs = make(map[string]Job)
+	}
+	return store, nil
+}
+
+func (s *FileRepository) SaveUser(_ context.Context, user StoredUser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Users[user.AccountId] = user
+	return s.flush()
+}
+
+func (s *FileRepository) SaveReport(_ context.Context, report Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report.Entries = nil
+	s.data.Reports[report.Id] = report
+	return s.flush()
+}
+
+func (s *FileRepository) DeleteReport(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.deleteReport(id); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+func (s *FileRepository) SaveEntry(_ context.Context, entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Entries[entry.Id] = entry
+	return s.flush()
+}
+
+func (s *FileRepository) DeleteEntry(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data.Entries[id]; !ok {
+		return ErrNotFound
+	}
+	s.deleteEntry(id)
+	return s.flush()
+}
+
+func (s *FileRepository) SaveRevision(_ context.Context, revision Revision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Revisions[revision.EntryId] = append(s.data.Revisions[revision.EntryId], revision)
+	return s.flush()
+}
+
+func (s *FileRepository) ReviseEntry(_ context.Context, entry Entry, revision Revision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reviseEntry(entry, revision); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+func (s *FileRepository) SaveJob(_ context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Jobs[job.Id] = job
+	return s.flush()
+}
+
+// flush must be called with the lock held.
+func (s *FileRepository) flush() error {
+	raw, err := json.Marshal(s.data)
+	if err != nil {
+		return fmt.Errorf("encode data: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("create data directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("write data file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("replace data file: %w", err)
+	}
+	return nil
+}
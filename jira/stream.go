@@ -0,0 +1,106 @@
+package main
+
+import (
+	"JiraConnect/shared"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Events sent by /transform/stream, in the order an issue goes through them.
+const (
+	StreamQueued     = "queued"
+	StreamGenerating = "generating"
+	StreamPartial    = "partial"
+	StreamDone       = "done"
+	StreamFailed     = "failed"
+	// StreamComplete ends the stream with every result, as /transform/batch
+	// would have returned them.
+	StreamComplete = "complete"
+
+	streamKeepAlive = 15 * time.Second
+)
+
+// StreamText is a piece of an entry's raw text as the model writes it.
+type StreamText struct {
+	Key  string `json:"key"`
+	Text string `json:"text"`
+}
+
+// handleStreamTransform runs a batch like /transform/batch, reporting each
+// issue over Server-Sent Events as it moves along so the page can show
+// entries as they arrive.
+func handleStreamTransform(log *log.Logger, generator Generator, workers int, jiraConfig shared.JiraConfig, httpClient *http.Client, sessions *shared.Sessions, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		batch, ok := decodeBatch(w, r, log, jiraConfig, httpClient, sessions)
+		if !ok {
+			return
+		}
+
+		events, err := shared.NewEventStream(w)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		// A failed send means the page has gone; the request context is
+		// cancelled then too, which stops the remaining work.
+		send := func(event string, v any) {
+			if err := events.Send(event, v); err != nil && r.Context().Err() == nil {
+				log.Printf("stream %s event error: %v\n", event, err)
+			}
+		}
+
+		for _, key := range batch.keys {
+			send(StreamQueued, BatchResult{Key: key})
+		}
+
+		done, stopped := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(stopped)
+			ticker := time.NewTicker(streamKeepAlive)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					_ = events.KeepAlive()
+				}
+			}
+		}()
+
+		response := BatchResponse{Results: make([]BatchResult, len(batch.keys))}
+		forEachConcurrently(len(batch.keys), workers, func(i int) {
+			key := batch.keys[i]
+			// The issue stays queued until the provider's rate limit lets it go.
+			turn, err := takeTurn(r.Context(), generator)
+			if err != nil {
+				result := BatchResult{Key: key, Error: transformErrorMessage(err)}
+				send(StreamFailed, result)
+				response.Results[i] = result
+				return
+			}
+			send(StreamGenerating, BatchResult{Key: key})
+
+			result := batch.transform(r.Context(), log, turn, store, i, func(text string) {
+				send(StreamPartial, StreamText{Key: key, Text: text})
+			})
+			if result.Error != "" {
+				send(StreamFailed, result)
+			} else {
+				send(StreamDone, result)
+			}
+			response.Results[i] = result
+		})
+		close(done)
+		<-stopped
+
+		if err := r.Context().Err(); err != nil {
+			log.Println("stream cancelled:", err)
+			return
+		}
+
+		response.count()
+		send(StreamComplete, response)
+	}
+}
@@ -3,34 +3,123 @@ package main
 import (
 	"JiraConnect/shared"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"google.golang.org/genai"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 )
 
-type LLMConfig struct {
-	ApiKey string
-}
-
 type LLMResponse struct {
 	Heading     string   `json:"heading"`
 	Description string   `json:"description"`
 	Links       []string `json:"links"`
+	// PromptVersion isn't part of the model's schema; it is set afterwards.
+	PromptVersion string `json:"promptVersion,omitempty"`
 }
 
 type JSONPayload struct {
 	Heading     string   `json:"heading"`
 	Description []string `json:"description"`
 	TaskName    string   `json:"taskName"`
+	Start       string   `json:"start"`
+	End         string   `json:"end"`
 }
 
-func handlePartiallyGeneratedIssueTransform(log *log.Logger, config LLMConfig) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.Background()
+// IssueContent is the text an entry is generated from.
+type IssueContent struct {
+	Key         string
+	Url         string
+	Heading     string
+	Description string
+	Comments    string
+}
+
+// loadIssueContent reads the issue's summary and ADF description from Jira so
+// the prompt sees the whole description rather than what the page scraped.
+// A description posted by the page is only used when Jira can't be reached.
+func loadIssueContent(r *http.Request, log *log.Logger, payload JSONPayload, config shared.JiraConfig, httpClient *http.Client, sessions *shared.Sessions) (IssueContent, error) {
+	content := IssueContent{
+		Key:         payload.TaskName,
+		Heading:     payload.Heading,
+		Description: strings.Join(payload.Description, "\n"),
+	}
+	if payload.TaskName == "" {
+		return content, nil
+	}
 
+	client, site, err := siteClient(r, config, httpClient, sessions)
+	if err != nil {
+		return content, err
+	}
+	content.Url = site.Url + "/browse/" + payload.TaskName
+
+	loaded, err := client.IssueContent(r.Context(), log, payload.TaskName, commentFilter(r, payload))
+	if err != nil {
+		return content, err
+	}
+	loaded.Url = content.Url
+	if loaded.Description == "" {
+		loaded.Description = content.Description
+	}
+	return loaded, nil
+}
+
+// IssueContent reads everything the prompt needs for one issue.
+func (c *JiraClient) IssueContent(ctx context.Context, log *log.Logger, key string, filter CommentFilter) (IssueContent, error) {
+	content := IssueContent{Key: key}
+	issue, err := c.GetIssue(ctx, key, []string{"summary", "description"})
+	if err != nil {
+		return content, err
+	}
+	content.Heading = issue.Fields.Summary
+	content.Description = adfToMarkdown(issue.Fields.Description)
+
+	// Comments only add detail, so an entry is still generated without them.
+	comments, err := c.GetComments(ctx, key, filter)
+	if err != nil {
+		log.Println("issue comments error:", err)
+	}
+	content.Comments = commentsForPrompt(comments, commentBudget)
+	return content, nil
+}
+
+// commentFilter keeps the caller's own comments plus anything posted in the
+// reporting month, when the page sends one.
+func commentFilter(r *http.Request, payload JSONPayload) CommentFilter {
+	var filter CommentFilter
+	user, ok := shared.UserFromContext(r.Context())
+	if ok {
+		filter.AccountId = user.AccountId
+	}
+	if period, err := parsePeriod(payload.Start, payload.End, userLocation(user)); err == nil {
+		filter.Period = &period
+	}
+	return filter
+}
+
+// writeGenerationError reports a failed model call. Nothing is written when the
+// caller has gone away, since there is no one left to read it.
+func writeGenerationError(w http.ResponseWriter, log *log.Logger, err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		log.Println("generation cancelled:", err)
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "Generation timed out", http.StatusGatewayTimeout)
+		log.Println("generation timed out:", err)
+	default:
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		log.Println("generation error:", err)
+	}
+}
+
+func handlePartiallyGeneratedIssueTransform(log *log.Logger, generator Generator, jiraConfig shared.JiraConfig, httpClient *http.Client, sessions *shared.Sessions, store Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		var payload JSONPayload
 
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
@@ -38,71 +127,105 @@ func handlePartiallyGeneratedIssueTransform(log *log.Logger, config LLMConfig) h
 			return
 		}
 
-		styleGuidePath := "jira/templates/style-guide.md"
-		styleGuideContent, err := os.ReadFile(styleGuidePath)
+		content, err := loadIssueContent(r, log, payload, jiraConfig, httpClient, sessions)
 		if err != nil {
-			http.Error(w, "failed to read style guide", http.StatusInternalServerError)
-			log.Printf("error reading style guide: %v", err)
-			return
+			if content.Description == "" {
+				http.Error(w, "Error retrieving issue", http.StatusBadGateway)
+				log.Println("issue content error:", err)
+				return
+			}
+			log.Println("using posted description, issue content error:", err)
 		}
 
-		client, err := genai.NewClient(ctx, &genai.ClientConfig{
-			APIKey: config.ApiKey,
-		})
+		log.Printf("generating results for prompt")
+		// Generation follows the request, so a closed tab or a regenerate
+		// click stops the model call instead of paying for it.
+		result, err := generateEntry(r.Context(), generator, content)
 		if err != nil {
-			http.Error(w, "internal server error", http.StatusInternalServerError)
-			log.Println(err)
+			writeGenerationError(w, log, err)
 			return
 		}
 
-		prompt := fmt.Sprintf(
-			"%s\n\nUse the above style guide to transform the following input:\n\nHeading: %s\nDescription: %s\nTask Name: %s",
-			string(styleGuideContent),
-			payload.Heading,
-			payload.Description,
-			payload.TaskName,
-		)
-
-		config := &genai.GenerateContentConfig{
-			ResponseMIMEType: "application/json",
-			ResponseSchema: &genai.Schema{
-				Type: genai.TypeObject,
-				Properties: map[string]*genai.Schema{
-					"heading":     {Type: genai.TypeString},
-					"description": {Type: genai.TypeString},
-					"links": {
-						Type:  genai.TypeArray,
-						Items: &genai.Schema{Type: genai.TypeString},
-					},
-				},
-				PropertyOrdering: []string{"heading", "description", "links"},
-			},
+		// The entry is kept so it is still there after the page is closed.
+		user, _ := shared.UserFromContext(r.Context())
+		entry := Entry{
+			AccountId:     user.AccountId,
+			Key:           content.Key,
+			Url:           content.Url,
+			Heading:       result.Heading,
+			Description:   result.Description,
+			Links:         result.Links,
+			PromptVersion: result.PromptVersion,
+		}
+		if err := createEntry(r.Context(), store, &entry, RevisionSourceModel, user); err != nil {
+			log.Println("unable to store entry:", err)
 		}
 
-		log.Printf("generating results for prompt")
-		rawText, err := client.Models.GenerateContent(
-			ctx,
-			"gemini-2.0-flash",
-			genai.Text(prompt),
-			config,
-		)
-
-		if err != nil {
+		if err := shared.Encode(w, http.StatusOK, entry); err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			log.Println(err)
-			return
 		}
+	}
+}
 
-		var result LLMResponse
-		if err := json.Unmarshal([]byte(rawText.Text()), &result); err != nil {
-			http.Error(w, "failed to parse model output", http.StatusInternalServerError)
-			log.Println("JSON parse error:", err)
-			return
-		}
+const (
+	styleGuidePath = "jira/templates/style-guide.md"
+	// generationTimeout bounds a single model call.
+	generationTimeout = 90 * time.Second
+	// promptTemplateVersion is bumped whenever the prompt wording below
+	// changes. Edits to the style guide are picked up by its hash instead.
+	promptTemplateVersion = "1"
+)
 
-		if err := shared.Encode(w, http.StatusOK, result); err != nil {
-			http.Error(w, "internal server error", http.StatusInternalServerError)
-			log.Println(err)
-		}
+// promptVersion identifies the prompt and style guide an entry was generated
+// with, so stored entries can be told apart after either changes.
+func promptVersion(styleGuide []byte) string {
+	sum := sha256.Sum256(styleGuide)
+	return promptTemplateVersion + "-" + hex.EncodeToString(sum[:6])
+}
+
+// buildPrompt asks for an entry in the style guide's format. It is the same
+// for every provider so entries don't depend on which model wrote them.
+func buildPrompt(styleGuide []byte, content IssueContent) string {
+	prompt := fmt.Sprintf(
+		"%s\n\nUse the above style guide to transform the following input:\n\nHeading: %s\nDescription:\n%s\nTask Name: %s",
+		string(styleGuide),
+		content.Heading,
+		content.Description,
+		content.Key,
+	)
+	if content.Comments != "" {
+		prompt += "\n\nComments (the work is often described here rather than in the description):\n" + content.Comments
+	}
+	return prompt
+}
+
+// generateEntry runs one issue through the generator using the style guide,
+// giving up after generationTimeout.
+func generateEntry(ctx context.Context, generator Generator, content IssueContent) (LLMResponse, error) {
+	return generateEntryStream(ctx, generator, content, nil)
+}
+
+// generateEntryStream is generateEntry, also passing the answer's text to
+// onText as it is written when the provider streams.
+func generateEntryStream(ctx context.Context, generator Generator, content IssueContent, onText func(text string)) (LLMResponse, error) {
+	var result LLMResponse
+
+	styleGuideContent, err := os.ReadFile(styleGuidePath)
+	if err != nil {
+		return result, fmt.Errorf("read style guide: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, generationTimeout)
+	defer cancel()
+
+	result, err = generate(ctx, generator, Prompt{
+		Text:    buildPrompt(styleGuideContent, content),
+		Content: content,
+	}, onText)
+	if err != nil {
+		return result, err
 	}
+	result.PromptVersion = promptVersion(styleGuideContent)
+	return result, nil
 }
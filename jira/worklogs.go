@@ -0,0 +1,217 @@
+package main
+
+import (
+	"JiraConnect/shared"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	worklogPageSize  = 1000
+	worklogPageLimit = 20
+	// worklogLookback catches entries started before the period that run into
+	// it, such as a late shift on the last day of the previous month.
+	worklogLookback = 24 * time.Hour
+)
+
+var worklogScopes = shared.NewScopes(append(issueScopes, shared.ScopeReadIssueWorklog)...)
+
+type IssueHours struct {
+	Key     string  `json:"key"`
+	Summary string  `json:"summary"`
+	Url     string  `json:"url"`
+	Entries int     `json:"entries"`
+	Seconds int     `json:"seconds"`
+	Hours   float64 `json:"hours"`
+}
+
+type WorklogSummary struct {
+	AccountId    string       `json:"accountId"`
+	Start        string       `json:"start"`
+	End          string       `json:"end"`
+	Issues       []IssueHours `json:"issues"`
+	TotalSeconds int          `json:"totalSeconds"`
+	TotalHours   float64      `json:"totalHours"`
+}
+
+type jiraWorklog struct {
+	Id               string      `json:"id"`
+	Author           JiraAccount `json:"author"`
+	Started          string      `json:"started"`
+	TimeSpentSeconds int         `json:"timeSpentSeconds"`
+}
+
+type worklogPage struct {
+	StartAt  int           `json:"startAt"`
+	Total    int           `json:"total"`
+	Worklogs []jiraWorklog `json:"worklogs"`
+}
+
+// WorklogJQL finds issues with time logged by accountId around the period.
+func WorklogJQL(accountId string, period Period) string {
+	return fmt.Sprintf(
+		"worklogAuthor = %s AND worklogDate >= %s AND worklogDate <= %s ORDER BY key ASC",
+		quoteJQL(accountId),
+		quoteJQL(period.Start.Add(-worklogLookback).Format(issueDateLayout)),
+		quoteJQL(period.End.Format(issueDateLayout)),
+	)
+}
+
+func (c *JiraClient) GetWorklogs(ctx context.Context, key string, period Period) ([]jiraWorklog, error) {
+	if !issueKeyPattern.MatchString(key) {
+		return nil, fmt.Errorf("invalid issue key %q", key)
+	}
+
+	var worklogs []jiraWorklog
+	startAt := 0
+
+	for page := 0; page < worklogPageLimit; page++ {
+		query := url.Values{}
+		query.Set("startAt", strconv.Itoa(startAt))
+		query.Set("maxResults", strconv.Itoa(worklogPageSize))
+		query.Set("startedAfter", strconv.FormatInt(period.Start.Add(-worklogLookback).UnixMilli(), 10))
+		query.Set("startedBefore", strconv.FormatInt(period.End.AddDate(0, 0, 1).UnixMilli(), 10))
+
+		var res worklogPage
+		if err := c.Get(ctx, "/rest/api/3/issue/"+key+"/worklog", query, &res); err != nil {
+			return nil, err
+		}
+		worklogs = append(worklogs, res.Worklogs...)
+
+		startAt += len(res.Worklogs)
+		if len(res.Worklogs) == 0 || startAt >= res.Total {
+			return worklogs, nil
+		}
+	}
+
+	return worklogs, fmt.Errorf("worklogs for %s exceeded %d pages", key, worklogPageLimit)
+}
+
+// secondsInPeriod counts only the part of an entry that falls inside the
+// period, so an entry crossing midnight at a month boundary is split between
+// the two months rather than counted twice or not at all.
+func secondsInPeriod(worklog jiraWorklog, period Period) int {
+	started, err := parseJiraTime(worklog.Started)
+	if err != nil {
+		return 0
+	}
+	ended := started.Add(time.Duration(worklog.TimeSpentSeconds) * time.Second)
+
+	start := latest(started, period.Start)
+	end := earliest(ended, period.End.AddDate(0, 0, 1))
+	if !start.Before(end) {
+		return 0
+	}
+	return int(end.Sub(start).Seconds())
+}
+
+func toHours(seconds int) float64 {
+	return math.Round(float64(seconds)/36) / 100
+}
+
+// SummariseWorklogs totals accountId's time per issue for the period. Issues
+// with nothing logged inside the period are left out.
+func (c *JiraClient) SummariseWorklogs(ctx context.Context, site shared.Site, accountId string, period Period) (WorklogSummary, error) {
+	summary := WorklogSummary{
+		AccountId: accountId,
+		Start:     period.Start.Format(issueDateLayout),
+		End:       period.End.Format(issueDateLayout),
+		Issues:    []IssueHours{},
+	}
+
+	issues, err := c.SearchIssues(ctx, WorklogJQL(accountId, period), []string{"summary"})
+	if err != nil {
+		return summary, err
+	}
+
+	for _, issue := range issues {
+		worklogs, err := c.GetWorklogs(ctx, issue.Key, period)
+		if err != nil {
+			return summary, err
+		}
+
+		hours := IssueHours{
+			Key:     issue.Key,
+			Summary: issue.Fields.Summary,
+			Url:     site.Url + "/browse/" + issue.Key,
+		}
+		for _, worklog := range worklogs {
+			if worklog.Author.AccountId != accountId {
+				continue
+			}
+			if seconds := secondsInPeriod(worklog, period); seconds > 0 {
+				hours.Entries++
+				hours.Seconds += seconds
+			}
+		}
+		if hours.Seconds == 0 {
+			continue
+		}
+
+		hours.Hours = toHours(hours.Seconds)
+		summary.Issues = append(summary.Issues, hours)
+		summary.TotalSeconds += hours.Seconds
+	}
+
+	sort.SliceStable(summary.Issues, func(i, j int) bool {
+		return summary.Issues[i].Seconds > summary.Issues[j].Seconds
+	})
+	summary.TotalHours = toHours(summary.TotalSeconds)
+	return summary, nil
+}
+
+// handleWorklogHours reports hours per issue for a period. It defaults to the
+// signed in user; author= picks someone else's worklogs on the same site. Days
+// are always the signed in user's, since that is who picked the dates.
+func handleWorklogHours(log *log.Logger, config shared.JiraConfig, httpClient *http.Client, sessions *shared.Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		user, _ := shared.UserFromContext(r.Context())
+		period, err := parsePeriod(params.Get("start"), params.Get("end"), userLocation(user))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		accountId := params.Get("author")
+		if accountId == "" {
+			accountId = user.AccountId
+		}
+		if accountId == "" {
+			http.Error(w, "author is required", http.StatusBadRequest)
+			return
+		}
+
+		client, site, err := siteClient(r, config, httpClient, sessions)
+		if err != nil {
+			http.Error(w, "Unable to resolve Jira site", http.StatusBadGateway)
+			log.Println("site resolution error:", err)
+			return
+		}
+
+		summary, err := client.SummariseWorklogs(r.Context(), site, accountId, period)
+		if err != nil {
+			var jiraErr *JiraError
+			if errors.As(err, &jiraErr) && jiraErr.StatusCode == http.StatusUnauthorized {
+				http.Error(w, "Not authorised", http.StatusUnauthorized)
+			} else {
+				http.Error(w, "Error retrieving worklogs", http.StatusBadGateway)
+			}
+			log.Println("worklog error:", err)
+			return
+		}
+
+		if err := shared.Encode(w, http.StatusOK, summary); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Println(err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSecondsInPeriod(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	february, err := monthPeriod("2025-02", berlin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worklog := func(started string, hours float64) jiraWorklog {
+		return jiraWorklog{Started: started, TimeSpentSeconds: int(hours * 3600)}
+	}
+
+	tests := []struct {
+		name    string
+		worklog jiraWorklog
+		want    int
+	}{
+		{name: "inside", worklog: worklog("2025-02-10T09:00:00.000+0100", 2), want: 2 * 3600},
+		{name: "after midnight on the first", worklog: worklog("2025-02-01T00:30:00.000+0100", 1), want: 3600},
+		{name: "same instant logged from UTC", worklog: worklog("2025-01-31T23:30:00.000+0000", 1), want: 3600},
+		{name: "late on the last day of the month before", worklog: worklog("2025-01-31T23:30:00.000+0100", 1), want: 1800},
+		{name: "runs into the next month", worklog: worklog("2025-02-28T23:00:00.000+0100", 2), want: 3600},
+		{name: "the month before", worklog: worklog("2025-01-31T22:00:00.000+0100", 1), want: 0},
+		{name: "the month after", worklog: worklog("2025-03-01T00:00:00.000+0100", 1), want: 0},
+		{name: "unparseable start", worklog: worklog("yesterday", 1), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := secondsInPeriod(tt.worklog, february); got != tt.want {
+				t.Errorf("secondsInPeriod() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A minimal SpreadsheetML writer: one sheet of text and number cells, with a
+// bold style for header and total rows.
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+
+const xlsxPackageRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+// Cell styles, in cellXfs order: plain, bold, number, bold number.
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="0.00"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="4">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="164" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/>
+</cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>`
+
+// XLSXSheet collects rows for a single-sheet workbook.
+type XLSXSheet struct {
+	Name string
+
+	widths []float64
+	rows   strings.Builder
+	count  int
+}
+
+func NewXLSXSheet(name string) *XLSXSheet {
+	return &XLSXSheet{Name: name}
+}
+
+// Columns sets column widths, in characters.
+func (s *XLSXSheet) Columns(widths ...float64) {
+	s.widths = widths
+}
+
+// xlsxColumn turns a zero-based index into a column name: A, B, ... AA.
+func xlsxColumn(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// Row appends a row of cells. Cells are written as numbers when they are
+// float64 or int, and as inline strings otherwise. The sheet never writes
+// formulas, so text starting with "=" stays text.
+func (s *XLSXSheet) Row(bold bool, cells ...any) {
+	s.count++
+	style := 0
+	if bold {
+		style = 1
+	}
+
+	fmt.Fprintf(&s.rows, `<row r="%d">`, s.count)
+	for i, cell := range cells {
+		ref := fmt.Sprintf("%s%d", xlsxColumn(i), s.count)
+		switch value := cell.(type) {
+		case float64:
+			fmt.Fprintf(&s.rows, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style+2, strconv.FormatFloat(value, 'f', -1, 64))
+		case int:
+			fmt.Fprintf(&s.rows, `<c r="%s" s="%d"><v>%d</v></c>`, ref, style, value)
+		default:
+			text := fmt.Sprint(value)
+			if text == "" {
+				continue
+			}
+			fmt.Fprintf(&s.rows, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xmlEscape(text))
+		}
+	}
+	s.rows.WriteString("</row>\n")
+}
+
+// Bytes zips the workbook parts together.
+func (s *XLSXSheet) Bytes(created time.Time) ([]byte, error) {
+	workbook := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`, xmlEscape(s.Name))
+
+	var cols strings.Builder
+	if len(s.widths) > 0 {
+		cols.WriteString("<cols>")
+		for i, width := range s.widths {
+			fmt.Fprintf(&cols, `<col min="%d" max="%d" width="%.1f" customWidth="1"/>`, i+1, i+1, width)
+		}
+		cols.WriteString("</cols>\n")
+	}
+
+	sheet := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+` + cols.String() + `<sheetData>
+` + s.rows.String() + `</sheetData>
+</worksheet>`
+
+	return packageOpenXML([]openXMLPart{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxPackageRels},
+		{"xl/workbook.xml", workbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/worksheets/sheet1.xml", sheet},
+		{"xl/styles.xml", xlsxStyles},
+	}, created)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestXLSXColumn(t *testing.T) {
+	tests := map[int]string{0: "A", 1: "B", 25: "Z", 26: "AA", 27: "AB", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"}
+	for index, want := range tests {
+		if got := xlsxColumn(index); got != want {
+			t.Errorf("xlsxColumn(%d) = %q, want %q", index, got, want)
+		}
+	}
+}
+
+func TestXLSXSheetBytes(t *testing.T) {
+	sheet := NewXLSXSheet("Sheet & Co")
+	sheet.Columns(10, 20)
+	sheet.Row(true, "Name", "Hours")
+	sheet.Row(false, "a <b>", 1.5, 3, "")
+	sheet.Row(true, "=SUM(B1:B2)", 2.25)
+
+	out, err := sheet.Bytes(time.Date(2025, 2, 1, 9, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := openXMLParts(t, out)
+
+	if workbook := parts["xl/workbook.xml"]; !strings.Contains(workbook, `<sheet name="Sheet &amp; Co"`) {
+		t.Errorf("workbook.xml doesn't name the sheet: %s", workbook)
+	}
+
+	data := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<col min="1" max="1" width="10.0" customWidth="1"/><col min="2" max="2" width="20.0" customWidth="1"/>`,
+		`<c r="A1" s="1" t="inlineStr"><is><t xml:space="preserve">Name</t></is></c>`,
+		`<c r="A2" s="0" t="inlineStr"><is><t xml:space="preserve">a &lt;b&gt;</t></is></c>`,
+		`<c r="B2" s="2"><v>1.5</v></c>`,
+		`<c r="C2" s="0"><v>3</v></c>`,
+		`<c r="A3" s="1" t="inlineStr"><is><t xml:space="preserve">=SUM(B1:B2)</t></is></c>`,
+		`<c r="B3" s="3"><v>2.25</v></c>`,
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("sheet1.xml is missing %s", want)
+		}
+	}
+	if strings.Contains(data, `r="D2"`) {
+		t.Error("empty cells should be left out")
+	}
+	if strings.Contains(data, "<f>") {
+		t.Error("the sheet should never contain formulas")
+	}
+}
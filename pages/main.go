@@ -51,6 +51,9 @@ func GetConfig() *Config {
 		JiraConfig: shared.JiraConfig{
 			RedirectUrl: os.Getenv("REDIRECT_URL"),
 			Cid:         os.Getenv("CLIENT_ID"),
+			StateSecret: os.Getenv("STATE_SECRET"),
+			Pkce:        os.Getenv("OAUTH_PKCE") == "true",
+			Scopes:      shared.ScopesFromEnv(os.Getenv("OAUTH_SCOPES")),
 		},
 		ServerConfig: shared.ServerConfig{
 			Port:           os.Getenv("PORT"),
@@ -67,6 +70,13 @@ func run(ctx context.Context) error {
 	config := GetConfig()
 	logger := log.New(os.Stdout, "["+config.ServiceName+"] ", log.LstdFlags|log.Lshortfile)
 
+	if err := config.Scopes.Validate(); err != nil {
+		return err
+	}
+	if err := shared.ValidateStateSecret(config.StateSecret); err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
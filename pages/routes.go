@@ -34,10 +34,21 @@ func handleAuth(log *log.Logger) http.HandlerFunc {
 
 func handleRoot(log *log.Logger, config *Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, _ *http.Request) {
+		state, err := shared.NewAuthState(config.JiraConfig)
+		if err != nil {
+			http.Error(w, "Error preparing login", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if err := shared.SetStateCookie(w, config.StateSecret, state); err != nil {
+			http.Error(w, "Error preparing login", http.StatusInternalServerError)
+			log.Println("oauth state cookie error:", err)
+			return
+		}
 
 		data := Page{
 			Title:     "Zend",
-			ScriptUrl: template.JS(shared.SetAuthUrl(config.JiraConfig)),
+			ScriptUrl: template.JS(shared.SetAuthUrl(config.JiraConfig, state)),
 			DevMode:   config.DevMode,
 		}
 		tmpl, err := template.ParseFiles("pages/templates/index.html")
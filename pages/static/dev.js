@@ -1,6 +1,10 @@
-function monitorAuthTime() {
-    const COOKIES = getCookies();
-    const expires = new Date(COOKIES.expiry);
+async function monitorAuthTime() {
+    const {expiry, mode} = await JiraAPI.fetchSession();
+    if (mode === 'api_token') {
+        // API tokens don't expire with the session, so there is nothing to refresh.
+        return;
+    }
+    const expires = new Date(expiry);
     const refreshCount = localStorage.getItem('');
 
     document.getElementById('refresh-token').innerHTML = `${refreshCount ?? 0}`;
@@ -32,5 +36,5 @@ function monitorAuthTime() {
 
 document.addEventListener('auth-loaded', async () => {
     console.log("Dev Panel loaded");
-    monitorAuthTime();
+    await monitorAuthTime();
 });
\ No newline at end of file
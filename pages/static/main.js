@@ -1,4 +1,3 @@
-const JIRA_URI = "activecampaign.atlassian.net";
 const IFRAME_PARAMS = `status=no,location=no,toolbar=no,menubar=no,width=600,height=800,popup=yes`;
 const shortMonths = ['Jan', 'Feb', 'Mar', 'Apr', 'Jun', 'Jul', 'Aug', 'Sep', 'Oct', 'Nov', 'Dec'];
 const longMonths = [
@@ -8,13 +7,18 @@ const longMonths = [
 ];
 const REFRESH_COUNT_KEY = 'refresh_token';
 const transformAPI = {
-    generateEntry: async (event, taskName, heading, description) => {
+    // In-flight generations by issue key, aborted when the list is replaced so
+    // the server stops the model call instead of finishing it for no one
+    pending: {},
+    abortPending: () => {
+        Object.values(transformAPI.pending).forEach(controller => controller.abort());
+        transformAPI.pending = {};
+    },
+    generateEntry: async (event, taskName, heading) => {
         const btn = event.target;
-        const parsedDescription = [...description.childNodes.values().filter(node => {
-            if (node.nodeName.toLowerCase() === "ul") {
-                return true;
-            }
-        }).map(node => node.innerText)];
+        transformAPI.pending[taskName]?.abort();
+        const controller = new AbortController();
+        transformAPI.pending[taskName] = controller;
         try {
             if (btn) {
                 btn.classList.add('loading');
@@ -25,10 +29,13 @@ const transformAPI = {
             const response = await fetch(`/api/transform`, {
                 method: "POST",
                 credentials: 'include',
+                signal: controller.signal,
+                // The description is read from Jira server-side
                 body: JSON.stringify({
                     taskName,
                     heading,
-                    description: parsedDescription
+                    // Comments from the selected month are included as well as the user's own
+                    ...JiraAPI.period
                 })
             });
             if (!response.ok) {
@@ -40,9 +47,11 @@ const transformAPI = {
                 btn.removeAttribute('disabled');
             }
 
-            const result = await response.json();
-            document.getElementById(`${taskName}-result`).innerHTML = `<hr /><div>${result.heading}</div><div>${result.description}</div><ul><li>${result.links}</li></ul>`
+            transformAPI.renderEntry(await response.json());
         } catch (e) {
+            if (e.name === 'AbortError') {
+                return;
+            }
             if (btn) {
                 btn.classList.remove('loading');
                 btn.classList.add('failed');
@@ -50,11 +59,195 @@ const transformAPI = {
                 btn.removeAttribute('disabled');
             }
             console.error(e);
+        } finally {
+            if (transformAPI.pending[taskName] === controller) {
+                delete transformAPI.pending[taskName];
+            }
+        }
+    },
+    // Generates every listed issue in one request, updating each one as the
+    // server reports on it over Server-Sent Events
+    generateAll: async (event, keys) => {
+        const btn = event.target;
+        transformAPI.pending.all?.abort();
+        const controller = new AbortController();
+        transformAPI.pending.all = controller;
+        try {
+            btn.classList.remove('failed');
+            btn.innerText = 'Generating';
+            btn.setAttribute('disabled', true);
+
+            const response = await fetch(`/api/transform/stream`, {
+                method: 'POST',
+                credentials: 'include',
+                signal: controller.signal,
+                body: JSON.stringify({keys, ...JiraAPI.period})
+            });
+            if (!response.ok) {
+                throw new Error("Fetch failed");
+            }
+
+            const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+            let buffer = '';
+            while (true) {
+                const {value, done} = await reader.read();
+                if (done) {
+                    break;
+                }
+                // Events end with a blank line; the last piece may be incomplete
+                buffer += value;
+                const events = buffer.split('\n\n');
+                buffer = events.pop();
+                events.forEach(transformAPI.handleStreamEvent);
+            }
+            btn.innerText = 'Regenerate All Entries';
+        } catch (e) {
+            if (e.name === 'AbortError') {
+                return;
+            }
+            btn.classList.add('failed');
+            btn.innerText = 'Try Again? (Generation Failed)';
+            console.error(e);
+        } finally {
+            btn.removeAttribute('disabled');
+            if (transformAPI.pending.all === controller) {
+                delete transformAPI.pending.all;
+            }
+        }
+    },
+    handleStreamEvent: (raw) => {
+        let type = 'message';
+        let data = '';
+        for (const line of raw.split('\n')) {
+            if (line.startsWith('event: ')) {
+                type = line.slice('event: '.length);
+            } else if (line.startsWith('data: ')) {
+                data += line.slice('data: '.length);
+            }
+        }
+        // Keep-alive comments carry no data
+        if (!data) {
+            return;
+        }
+
+        const payload = JSON.parse(data);
+        const btn = document.querySelector(`#${payload.key}-details .generate-issue`);
+        const target = document.getElementById(`${payload.key}-result`);
+        if (!btn || !target) {
+            return;
+        }
+        switch (type) {
+            case 'queued':
+                btn.classList.remove('failed');
+                btn.innerText = 'Queued';
+                btn.setAttribute('disabled', true);
+                break;
+            case 'generating':
+                btn.classList.add('loading');
+                btn.innerText = 'Loading';
+                target.innerHTML = '<hr /><pre class="entry-preview"></pre>';
+                break;
+            case 'partial':
+                target.querySelector('.entry-preview')?.append(payload.text);
+                break;
+            case 'done':
+                btn.classList.remove('loading');
+                btn.innerText = 'Regenerate Tax Entry';
+                btn.removeAttribute('disabled');
+                transformAPI.renderEntry(payload.entry);
+                break;
+            case 'failed':
+                btn.classList.remove('loading');
+                btn.classList.add('failed');
+                btn.innerText = `Try Again? (${payload.error})`;
+                btn.removeAttribute('disabled');
+                target.innerHTML = '';
+                break;
+        }
+    },
+    renderEntry: (entry) => {
+        const target = document.getElementById(`${entry.key}-result`);
+        if (!target) {
+            return;
+        }
+        // Entries hold model output over other people's comments, so none of it is parsed as markup
+        const heading = document.createElement('div');
+        heading.setAttribute('class', 'entry-heading');
+        heading.setAttribute('contenteditable', 'true');
+        heading.textContent = entry.heading;
+
+        const description = document.createElement('div');
+        description.setAttribute('class', 'entry-description');
+        description.setAttribute('contenteditable', 'true');
+        description.textContent = entry.description;
+
+        const links = document.createElement('ul');
+        for (const link of entry.links ?? []) {
+            const li = document.createElement('li');
+            li.textContent = link;
+            links.appendChild(li);
+        }
+
+        target.replaceChildren(document.createElement('hr'), heading, description, links);
+
+        // Edits are saved as a new revision, so the model's text is kept for review
+        const save = document.createElement('button');
+        save.setAttribute('class', 'cta small');
+        save.innerText = `Save changes (revision ${entry.revision})`;
+        save.addEventListener('click', () => transformAPI.saveEntry(entry, target, save));
+        target.appendChild(save);
+    },
+    saveEntry: async (entry, target, btn) => {
+        try {
+            btn.setAttribute('disabled', true);
+            const response = await fetch(`/api/entries/${entry.id}`, {
+                method: 'PUT',
+                credentials: 'include',
+                body: JSON.stringify({
+                    heading: target.querySelector('.entry-heading').innerText,
+                    description: target.querySelector('.entry-description').innerText,
+                    links: entry.links,
+                    hours: entry.hours,
+                    revision: entry.revision
+                })
+            });
+            if (response.status === 409) {
+                btn.innerText = 'Changed elsewhere - reload to edit';
+                return;
+            }
+            if (!response.ok) {
+                throw new Error("Save failed");
+            }
+            transformAPI.renderEntry(await response.json());
+        } catch (e) {
+            btn.classList.add('failed');
+            btn.innerText = 'Try Again? (Save Failed)';
+            btn.removeAttribute('disabled');
+            console.error(e);
+        }
+    },
+    // Entries are stored server-side, so previous results survive a reload
+    restoreEntries: async () => {
+        try {
+            const response = await fetch(`/api/entries`, {
+                method: 'GET',
+                credentials: 'include',
+                headers: {Accept: 'application/json'}
+            });
+            if (!response.ok) {
+                throw new Error("Fetch failed");
+            }
+            // Oldest first, so the latest entry for each issue wins
+            const entries = await response.json();
+            entries.forEach(transformAPI.renderEntry);
+        } catch (e) {
+            console.error(e);
         }
     }
 }
 
 const JiraAPI = {
+    period: {},
     formatDate: (date) => {
         const yyyy = date.getFullYear();
         const mm = String(date.getMonth() + 1).padStart(2, '0');
@@ -77,6 +270,7 @@ const JiraAPI = {
                 end = JiraAPI.formatDate(defaultEnd);
             }
 
+            JiraAPI.period = {start, end};
             const data = await JiraAPI.fetchIssues(start, end);
 
             // Switch statement
@@ -108,8 +302,7 @@ const JiraAPI = {
         list.id = 'issues-list';
         list.setAttribute('class', 'issues-list');
         for (const issue of issues) {
-            const {key, renderedFields: {description}, fields: {summary, updated, issuetype}} = issue;
-            localStorage.setItem(`issue-${key}`, description);
+            const {key, description, summary, updated, activity, issueType: issuetype} = issue;
             const listItem = document.createElement('li');
             listItem.setAttribute('class', 'issue-type');
 
@@ -139,44 +332,50 @@ const JiraAPI = {
                             <h4 class="title">${key} - ${summary}</h4>
                             <div id="${key}-description" class="task-description"></div>
                             <aside class="sub-issue">Last Updated on ${addFormattedTime(updated)}</aside>
+                            <ul id="${key}-activity" class="sub-issue activity-reasons"></ul>
                             <aside class="button-group"></aside>
                             <div id="${key}-result"></div>
                         </article>
                     </section>
                 `;
             listItem.querySelector(`#${key}-description`).innerHTML = description;
-            button.addEventListener('click', event => transformAPI.generateEntry(event, key, summary, listItem.querySelector(`#${key}-description`)));
+            // Why this issue is in the selected month, from its changelog
+            const reasons = listItem.querySelector(`#${key}-activity`);
+            for (const reason of activity?.reasons ?? []) {
+                const li = document.createElement('li');
+                li.textContent = reason;
+                reasons.appendChild(li);
+            }
+            button.addEventListener('click', event => transformAPI.generateEntry(event, key, summary));
 
             listItem.querySelector(`#${key}-details .button-group`).appendChild(button);
             list.appendChild(listItem);
         }
 
+        const generateAll = document.createElement('button');
+        generateAll.setAttribute('class', 'generate-all cta');
+        generateAll.innerText = 'Generate All Entries';
+        const keys = issues.map(issue => issue.key);
+        generateAll.addEventListener('click', event => transformAPI.generateAll(event, keys));
+
+        transformAPI.abortPending();
         document.getElementById('issue-container').innerHTML = '';
+        if (keys.length > 0) {
+            document.getElementById('issue-container').append(generateAll);
+        }
         document.getElementById('issue-container').append(list);
+        transformAPI.restoreEntries();
     },
     triggerPopup: (url) => {
         window.open(url, '_blank', IFRAME_PARAMS);
     },
     fetchIssues: async (start, end) => {
         try {
-            const COOKIES = getCookies();
-            const user = getSavedUser();
-            const apiKey = sessionStorage.getItem('apiKey');
-            let auth = `Bearer ${COOKIES.oauth_token}`;
-            let token = '';
-            if (user.email && apiKey) {
-                token = btoa(`${user.email}:${apiKey}`);
-                auth = "Basic " + token;
-            }
-
-            const jql = encodeURI(`assignee = currentUser() AND statusCategoryChangedDate >= \"${start}\" AND statusCategoryChangedDate <= \"${end}\" ORDER BY statusCategoryChangedDate DESC`);
-            const response = await fetch(`/cors/${JIRA_URI}/rest/api/3/search/jql?expand=renderedFields&fields=issuetype,summary,description,created,updated&jql=${jql}`, {
+            const params = new URLSearchParams({start, end});
+            const response = await fetch(`/api/issues?${params}`, {
                 method: 'GET',
-                headers: {
-                    Accept: 'application/json',
-                    Authorization: auth,
-                    'X-Requested-With': 'XMLHttpRequest'
-                }
+                credentials: 'include',
+                headers: {Accept: 'application/json'}
             });
 
             if (!response.ok) {
@@ -188,14 +387,53 @@ const JiraAPI = {
             console.error(e);
         }
     },
-    fetchUser: async () => {
+    loadSites: async () => {
         try {
-            const COOKIES = getCookies();
-            const response = await fetch(`https://api.atlassian.com/me`, {
-                headers: {
-                    Authorization: `Bearer ${COOKIES.oauth_token}`
+            const response = await fetch(`/api/sites`, {credentials: 'include'});
+            if (!response.ok) {
+                throw new Error("Fetch failed");
+            }
+
+            const {sites, selected} = await response.json();
+            const picker = document.getElementById('site-picker');
+            if (!picker || !sites || sites.length < 2) {
+                return;
+            }
+
+            picker.innerHTML = '';
+            for (const site of sites) {
+                const option = document.createElement('option');
+                option.value = site.id;
+                option.textContent = site.name;
+                option.selected = site.id === selected;
+                picker.appendChild(option);
+            }
+            picker.style.display = 'block';
+            picker.addEventListener('change', async event => {
+                const response = await fetch(`/api/sites/select`, {
+                    method: 'POST',
+                    credentials: 'include',
+                    body: JSON.stringify({cloudId: event.target.value})
+                });
+                if (!response.ok) {
+                    console.error('Error selecting site');
+                    return;
                 }
+                await JiraAPI.loadIssues();
             });
+        } catch (e) {
+            console.error('Error fetching sites: ', e);
+        }
+    },
+    fetchUser: async () => {
+        try {
+            const response = await fetch(`/api/me`, {credentials: 'include'});
+            if (response.status === 401) {
+                return null;
+            }
+            if (!response.ok) {
+                throw new Error('Request failed');
+            }
 
             return await response.json();
         } catch (e) {
@@ -204,12 +442,17 @@ const JiraAPI = {
             return getSavedUser();
         }
     },
+    fetchSession: async () => {
+        const response = await fetch(`/api/session`, {credentials: 'include'});
+        if (!response.ok) {
+            throw new Error('Request failed');
+        }
+        return await response.json();
+    },
     refreshSession: async () => {
         try {
-            const COOKIES = getCookies();
             const response = await fetch(`/api/refresh`, {
                 method: 'POST',
-                headers: {'x-refresh': COOKIES['refresh_token']},
                 credentials: 'include'
             });
             if (!response.ok) {
@@ -225,20 +468,43 @@ const JiraAPI = {
             window.location.reload();
         }
     },
+    saveApiToken: async (email, token, site) => {
+        const response = await fetch(`/api/credentials`, {
+            method: 'POST',
+            credentials: 'include',
+            body: JSON.stringify({email, token, site})
+        });
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        return await response.json();
+    },
+    removeApiToken: async () => {
+        const response = await fetch(`/api/credentials/remove`, {
+            method: 'POST',
+            credentials: 'include'
+        });
+        if (!response.ok) {
+            throw new Error('Request failed');
+        }
+    },
     startAuthFlow: async () => {
-        const COOKIES = getCookies();
-        if (!!COOKIES?.oauth_token) {
-            await setAuth();
+        const user = await JiraAPI.fetchUser();
+        if (user && user.email) {
+            await setAuth(user);
             document.dispatchEvent(new CustomEvent('auth-loaded'));
+        } else {
+            bindApiTokenPanel(null);
         }
     }
 }
 
-const COOKIE_LIST = ['oauth_token', 'scopes', 'expiry', 'refresh_token'];
+// Cookies set before sessions moved server-side; cleared on logout.
+const COOKIE_LIST = ['oauth_token', 'scopes', 'expiry', 'refresh_token', 'cloud_id'];
 const USER_KEY = 'user';
 
-async function setAuth() {
-    const {name, email, picture} = await JiraAPI.fetchUser();
+async function setAuth(user) {
+    const {name, email, picture} = user;
     window.document.title = `Hello ${name}` + window.document.title.replace('Log in', ' ');
     localStorage.setItem(USER_KEY, JSON.stringify({name, email, picture}));
     document.getElementById("auth-container").style.display = "block";
@@ -252,33 +518,46 @@ async function setAuth() {
     document.getElementById("logout").style.display = "block";
     document.getElementById("user").appendChild(avatar);
     document.getElementById('user-details').style.display = 'flex';
-    document.getElementById('api-token-panel').style.display = 'block';
 
+    const session = await JiraAPI.fetchSession();
+    bindApiTokenPanel(session);
 
-    if (sessionStorage.getItem('apiKey')) {
-        document.getElementById('api-panel').style.display = 'none';
-        document.getElementById('remove-token').style.display = 'block';
-    } else {
-        document.getElementById("api-panel").style.display = 'block';
-        document.getElementById('remove-token').style.display = 'none';
-    }
-    document.getElementById('remove-api-token').addEventListener('click', event => {
+    await JiraAPI.loadSites();
+    await JiraAPI.loadIssues();
+    loadMonthPicker();
+}
+
+// The API token is posted once and kept in the server session; the page only
+// learns which mode the session is in.
+function bindApiTokenPanel(session) {
+    const usingToken = session?.mode === 'api_token';
+    document.getElementById('api-token-panel').style.display = 'block';
+    document.getElementById('api-panel').style.display = usingToken ? 'none' : 'block';
+    document.getElementById('remove-token').style.display = usingToken ? 'block' : 'none';
+
+    document.getElementById('remove-api-token').addEventListener('click', async event => {
         event.preventDefault();
-        sessionStorage.removeItem('apiKey');
-        document.getElementById('api-panel').style.display = 'block';
-        document.getElementById('remove-token').style.display = 'none';
+        try {
+            await JiraAPI.removeApiToken();
+        } catch (e) {
+            console.error('Error removing API token: ', e);
+        }
+        window.location.reload();
     });
     document.getElementById('api-panel').addEventListener('submit', async event => {
         event.preventDefault();
-        const apiKey = event.target.querySelector('input[name="add-api-token"]').value;
-        sessionStorage.setItem('apiKey', apiKey);
-        await JiraAPI.loadIssues();
-        document.getElementById('api-panel').style.display = 'none';
-        document.getElementById('remove-token').style.display = 'block';
+        const form = event.target;
+        try {
+            await JiraAPI.saveApiToken(
+                form.querySelector('input[name="api-email"]').value || getSavedUser().email,
+                form.querySelector('input[name="add-api-token"]').value,
+                form.querySelector('input[name="api-site"]').value
+            );
+            window.location.reload();
+        } catch (e) {
+            console.error('Error saving API token: ', e);
+        }
     });
-
-    await JiraAPI.loadIssues();
-    loadMonthPicker();
 }
 
 function deleteCookie(name) {
@@ -286,11 +565,16 @@ function deleteCookie(name) {
     document.cookie = `${name}=; expires=Thu, 01 Jan 1970 00:00:00 UTC; path=/;`;
 }
 
-function logout() {
+async function logout() {
+    try {
+        await fetch(`/api/logout`, {method: 'POST', credentials: 'include'});
+    } catch (e) {
+        console.error('Error ending session: ', e);
+    }
+
     COOKIE_LIST.forEach(deleteCookie);
     localStorage.removeItem(USER_KEY);
 
-    sessionStorage.removeItem('apiKey');
     document.getElementById("api-panel").style.display = 'block';
     document.getElementById('remove-token').style.display = 'none';
 
@@ -299,22 +583,6 @@ function logout() {
 }
 
 
-function getCookies() {
-    const cookies = document.cookie.split(';');
-    return cookies.reduce((acc, cookieStr) => {
-        const [key, val] = cookieStr.split('=');
-        const findKey = key.toLowerCase().trim();
-        if (COOKIE_LIST.includes(findKey)) {
-            return {
-                ...acc,
-                [findKey]: val
-            }
-        }
-        return acc;
-    }, {});
-}
-
-
 function getSavedUser() {
 
     const data = localStorage.getItem(USER_KEY);
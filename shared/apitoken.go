@@ -0,0 +1,110 @@
+package shared
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var ErrInvalidSite = errors.New("site must be an https://<name>.atlassian.net address")
+
+// ApiToken is an Atlassian account API token. It is the fallback for orgs that
+// block third-party OAuth apps and is sent to the site itself with Basic auth.
+type ApiToken struct {
+	Email   string `json:"email"`
+	Token   string `json:"token"`
+	SiteUrl string `json:"siteUrl"`
+}
+
+func (t ApiToken) Authorization() string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(t.Email+":"+t.Token))
+}
+
+func (t ApiToken) Site() Site {
+	host := strings.TrimPrefix(t.SiteUrl, "https://")
+	return Site{
+		Url:  t.SiteUrl,
+		Name: strings.TrimSuffix(host, ".atlassian.net"),
+	}
+}
+
+// NormaliseSiteUrl accepts "name", "name.atlassian.net" or a full URL and
+// returns the https origin. Only Atlassian hosts are allowed so a credential
+// can't be sent somewhere else on the caller's behalf.
+func NormaliseSiteUrl(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ErrInvalidSite
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" || parsed.Port() != "" {
+		return "", ErrInvalidSite
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	if !strings.Contains(host, ".") {
+		host += ".atlassian.net"
+	}
+	if !strings.HasSuffix(host, ".atlassian.net") {
+		return "", ErrInvalidSite
+	}
+	return "https://" + host, nil
+}
+
+// GetJiraMyself resolves an API token to its user via the site's own
+// /rest/api/3/myself, since api.atlassian.com/me only accepts OAuth tokens.
+func GetJiraMyself(ctx context.Context, client *http.Client, token ApiToken) (User, error) {
+	var user User
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, token.SiteUrl+"/rest/api/3/myself", nil)
+	if err != nil {
+		return user, fmt.Errorf("build myself request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", token.Authorization())
+
+	res, err := client.Do(req)
+	if err != nil {
+		return user, fmt.Errorf("myself request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+		return user, fmt.Errorf("myself responded with status %d: %w", res.StatusCode, ErrTokenRejected)
+	}
+	if res.StatusCode != http.StatusOK {
+		return user, fmt.Errorf("myself responded with status %d", res.StatusCode)
+	}
+
+	var myself struct {
+		AccountId    string            `json:"accountId"`
+		EmailAddress string            `json:"emailAddress"`
+		DisplayName  string            `json:"displayName"`
+		AvatarUrls   map[string]string `json:"avatarUrls"`
+		TimeZone     string            `json:"timeZone"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&myself); err != nil {
+		return user, fmt.Errorf("decode myself: %w", err)
+	}
+
+	user = User{
+		AccountId: myself.AccountId,
+		Name:      myself.DisplayName,
+		Email:     myself.EmailAddress,
+		Picture:   myself.AvatarUrls["48x48"],
+		TimeZone:  myself.TimeZone,
+	}
+	// Jira hides emailAddress for some privacy settings; the caller told us it.
+	if user.Email == "" {
+		user.Email = token.Email
+	}
+	return user, nil
+}
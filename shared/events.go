@@ -0,0 +1,58 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// EventStream writes Server-Sent Events whose data is JSON, in the same
+// shapes Encode would send. It is safe to use from several goroutines.
+type EventStream struct {
+	mu         sync.Mutex
+	w          http.ResponseWriter
+	controller *http.ResponseController
+}
+
+// NewEventStream sends the stream's headers. Nothing else should be written
+// to w afterwards except through the stream.
+func NewEventStream(w http.ResponseWriter) (*EventStream, error) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stops proxies such as nginx holding events back in a buffer.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &EventStream{w: w, controller: http.NewResponseController(w)}
+	if err := stream.controller.Flush(); err != nil {
+		return nil, fmt.Errorf("start event stream: %w", err)
+	}
+	return stream, nil
+}
+
+// Send writes one event and flushes it to the client.
+func (s *EventStream) Send(event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	return s.controller.Flush()
+}
+
+// KeepAlive writes a comment line, which clients ignore, so idle connections
+// aren't closed by proxies while nothing else is being sent.
+func (s *EventStream) KeepAlive() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprint(s.w, ": keep-alive\n\n"); err != nil {
+		return err
+	}
+	return s.controller.Flush()
+}
@@ -1,13 +1,13 @@
 package shared
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/google/uuid"
 	"log"
 	"net/http"
 	"net/url"
-	"strings"
-	"time"
 )
 
 type JiraConfig struct {
@@ -15,6 +15,11 @@ type JiraConfig struct {
 	RedirectUrl string
 	Secret      string
 	OauthUrl    string
+	RevokeUrl   string
+	ApiUrl      string
+	StateSecret string
+	Pkce        bool
+	Scopes      OauthScopes
 }
 
 type Oauth struct {
@@ -25,27 +30,65 @@ type Oauth struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-type OauthScopes = []string
-
-func SetAuthUrl(config JiraConfig) string {
-	scopes := OauthScopes{
-		"offline_access",
-		"read:me",
-		"read:project.avatar:jira",
-		"read:filter:jira",
-		"read:group:jira",
-		"read:issue:jira",
-		"read:attachment:jira",
-		"read:comment:jira",
-		"read:comment.property:jira",
-		"read:field:jira",
-		"read:issue-details:jira",
-		"read:field.default-value:jira",
-		"read:field.option:jira",
-		"read:field:jira",
-		"read:group:jira",
+const (
+	AtlassianApiUrl     = "https://api.atlassian.com"
+	accessibleResources = "/oauth/token/accessible-resources"
+)
+
+var ErrTokenRejected = errors.New("atlassian rejected the access token")
+
+// Site is a Jira Cloud instance returned by the accessible-resources endpoint.
+type Site struct {
+	Id        string   `json:"id"`
+	Url       string   `json:"url"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	AvatarUrl string   `json:"avatarUrl"`
+}
+
+func GetAccessibleResources(ctx context.Context, client *http.Client, accessToken string) ([]Site, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, AtlassianApiUrl+accessibleResources, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build accessible-resources request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("accessible-resources request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("accessible-resources responded with status %d", res.StatusCode)
+	}
+
+	var sites []Site
+	if err := json.NewDecoder(res.Body).Decode(&sites); err != nil {
+		return nil, fmt.Errorf("decode accessible-resources: %w", err)
+	}
+	return sites, nil
+}
+
+// FindSite returns the site matching cloudId, or the first reachable site when
+// cloudId is empty.
+func FindSite(sites []Site, cloudId string) (Site, bool) {
+	if len(sites) == 0 {
+		return Site{}, false
+	}
+	if cloudId == "" {
+		return sites[0], true
+	}
+	for _, site := range sites {
+		if site.Id == cloudId {
+			return site, true
+		}
 	}
+	return Site{}, false
+}
 
+func SetAuthUrl(config JiraConfig, state AuthState) string {
 	baseURL := "https://auth.atlassian.com/authorize"
 	params := url.Values{}
 	params.Set("audience", "api.atlassian.com")
@@ -53,94 +96,113 @@ func SetAuthUrl(config JiraConfig) string {
 	params.Set("redirect_uri", config.RedirectUrl)
 	params.Set("response_type", "code")
 	params.Set("prompt", "consent")
-
-	uniq, err := uuid.NewV7()
-
-	if err != nil {
-		log.Println(err)
-	} else {
-		params.Set("state", uniq.String())
+	params.Set("state", state.State)
+	if state.Verifier != "" {
+		params.Set("code_challenge", CodeChallenge(state.Verifier))
+		params.Set("code_challenge_method", "S256")
 	}
-
-	params.Set("scope", strings.Join(scopes, " "))
+	params.Set("scope", config.Scopes.String())
 
 	return fmt.Sprintf("%s?%s", baseURL, params.Encode())
 }
 
-func AuthGuard(log *log.Logger) func(h http.HandlerFunc) http.HandlerFunc {
+// AuthGuard loads the caller's session, verifies its token against Atlassian
+// and checks the granted scopes before the user is attached to the request.
+func AuthGuard(log *log.Logger, sessions *Sessions, verifier *TokenVerifier, required OauthScopes) func(h http.HandlerFunc) http.HandlerFunc {
 	log.Println("authGuard init")
 	return func(h http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			var isAuthed bool = false
-			for _, cookie := range r.Cookies() {
-				if cookie.Name == "oauth_token" {
-					isAuthed = true
-				}
+			session, err := sessions.Load(r.Context(), r)
+			if err != nil {
+				log.Printf("attempted to access auth route %s: %s\n", r.URL.Path, err)
+				denyAuth(w, log, http.StatusUnauthorized, ReasonNoSession, nil)
+				return
+			}
+
+			// API tokens act with the user's own permissions and carry no scopes.
+			if missing := MissingScopes(session.Token.Scope, required); session.ApiToken == nil && len(missing) > 0 {
+				log.Printf("session missing scopes for %s: %s\n", r.URL.Path, missing)
+				denyAuth(w, log, http.StatusForbidden, ReasonMissingScope, missing)
+				return
+			}
+
+			user, err := verifier.Verify(r.Context(), session)
+			if errors.Is(err, ErrTokenRejected) {
+				log.Printf("rejected token on %s: %s\n", r.URL.Path, err)
+				denyAuth(w, log, http.StatusUnauthorized, ReasonTokenInvalid, nil)
+				return
 			}
-			if isAuthed != true {
-				log.Printf("attempted to access auth route %s\n", r.URL.Path)
-				http.Error(w, "Not authorised", http.StatusUnauthorized)
+			if err != nil {
+				log.Printf("unable to verify token on %s: %s\n", r.URL.Path, err)
+				denyAuth(w, log, http.StatusBadGateway, ReasonVerificationFailed, nil)
 				return
 			}
 
-			h(w, r)
+			ctx := WithUser(WithSession(r.Context(), session), user)
+			h(w, r.WithContext(ctx))
 		}
 	}
 }
 
-func SetJiraCookie(w http.ResponseWriter, log *log.Logger, details Oauth) {
-	offsetExpiry := details.ExpiresIn - 60
-	if offsetExpiry < 0 != false {
-		log.Println("attempted to set cookie with negative expiry.")
-		http.Error(w, "Cookie cannot be set", http.StatusBadRequest)
-	}
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "oauth_token",
-		Value:    details.AccessToken,
-		Path:     "/",
-		MaxAge:   offsetExpiry,
-		HttpOnly: false,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-	})
-	http.SetCookie(w, &http.Cookie{
-		Name:     "scopes",
-		Value:    details.Scope,
-		Path:     "/",
-		MaxAge:   offsetExpiry,
-		HttpOnly: false,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-	})
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    details.RefreshToken,
-		Path:     "/",
-		MaxAge:   offsetExpiry,
-		HttpOnly: false,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-	})
-
-	now := time.Now().UTC()
-	futureTime := now.Add(time.Duration(offsetExpiry) * time.Second)
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "expiry",
-		Value:    futureTime.Format("2006-01-02T15:04:05.000Z"),
-		Path:     "/",
-		MaxAge:   offsetExpiry,
-		HttpOnly: false,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-	})
-	if err := Encode(w, http.StatusOK, Oauth{
-		Scope:     details.Scope,
-		TokenType: details.TokenType,
-	}); err != nil {
+func denyAuth(w http.ResponseWriter, log *log.Logger, status int, reason string, missing OauthScopes) {
+	if err := WriteAuthError(w, status, reason, missing); err != nil {
 		log.Println(err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
 	}
 }
+
+// User is the Atlassian account behind a session. TimeZone is the IANA zone
+// set on the account, which decides where the user's days begin.
+type User struct {
+	AccountId string `json:"account_id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Picture   string `json:"picture"`
+	TimeZone  string `json:"zoneinfo,omitempty"`
+}
+
+func GetCurrentUser(ctx context.Context, client *http.Client, accessToken string) (User, error) {
+	var user User
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, AtlassianApiUrl+"/me", nil)
+	if err != nil {
+		return user, fmt.Errorf("build me request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return user, fmt.Errorf("me request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+		return user, fmt.Errorf("me responded with status %d: %w", res.StatusCode, ErrTokenRejected)
+	}
+	if res.StatusCode != http.StatusOK {
+		return user, fmt.Errorf("me responded with status %d", res.StatusCode)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&user); err != nil {
+		return user, fmt.Errorf("decode me: %w", err)
+	}
+	return user, nil
+}
+
+// legacyCookies were written for the page to read before tokens moved into
+// the server session. They are still cleared on logout for older browsers.
+var legacyCookies = []string{"oauth_token", "scopes", "refresh_token", "expiry", "cloud_id"}
+
+// ClearJiraCookies expires every cookie the service has ever set.
+func ClearJiraCookies(w http.ResponseWriter) {
+	for _, name := range legacyCookies {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	ClearStateCookie(w)
+	ClearSessionCookie(w)
+}
@@ -0,0 +1,127 @@
+package shared
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// meClient answers /me and /myself by Authorization header: "Bearer good"
+// and Basic credentials are a known user, "Bearer revoked" is rejected and
+// anything else finds Atlassian down.
+func meClient() *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		status, body := http.StatusInternalServerError, ""
+		switch auth := r.Header.Get("Authorization"); {
+		case auth == "Bearer good":
+			status, body = http.StatusOK, `{"account_id":"me","name":"Me"}`
+		case strings.HasPrefix(auth, "Basic "):
+			status, body = http.StatusOK, `{"accountId":"me","displayName":"Me"}`
+		case auth == "Bearer revoked":
+			status = http.StatusUnauthorized
+		}
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})}
+}
+
+func TestAuthGuard(t *testing.T) {
+	store := NewMemorySessionStore()
+	now := time.Now().UTC()
+	session := func(id string, token Oauth) Session {
+		return Session{Id: id, Token: token, Expiry: now.Add(time.Hour), CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	}
+	apiToken := session("api", Oauth{})
+	apiToken.ApiToken = &ApiToken{Email: "me@example.com", Token: "token", SiteUrl: "https://example.atlassian.net"}
+	tokenExpired := session("token-expired", Oauth{AccessToken: "good", Scope: "read:me"})
+	tokenExpired.Expiry = now.Add(-time.Minute)
+	sessionExpired := session("session-expired", Oauth{AccessToken: "good", Scope: "read:me"})
+	sessionExpired.ExpiresAt = now.Add(-time.Minute)
+	for _, s := range []Session{
+		session("valid", Oauth{AccessToken: "good", Scope: "read:me read:jql:jira"}),
+		session("narrow", Oauth{AccessToken: "good", Scope: "read:me"}),
+		session("revoked", Oauth{AccessToken: "revoked", Scope: "read:me read:jql:jira"}),
+		session("unverifiable", Oauth{AccessToken: "down", Scope: "read:me read:jql:jira"}),
+		apiToken,
+		tokenExpired,
+		sessionExpired,
+	} {
+		if err := store.Save(t.Context(), s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	verifier := NewTokenVerifier()
+	verifier.http = meClient()
+	logger := log.New(io.Discard, "", 0)
+	guard := AuthGuard(logger, NewSessions(store, nil), verifier, NewScopes(ScopeReadMe, ScopeReadJql))
+	handler := guard(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+		session, _ := SessionFromContext(r.Context())
+		w.Write([]byte(user.AccountId + " " + session.Id))
+	})
+
+	tests := []struct {
+		name    string
+		session string
+		status  int
+		reason  string
+		missing OauthScopes
+		body    string
+	}{
+		{name: "valid", session: "valid", status: http.StatusOK, body: "me valid"},
+		{name: "api token carries no scopes", session: "api", status: http.StatusOK, body: "me api"},
+		{name: "no cookie", status: http.StatusUnauthorized, reason: ReasonNoSession},
+		{name: "unknown session", session: "unknown", status: http.StatusUnauthorized, reason: ReasonNoSession},
+		{name: "expired session", session: "session-expired", status: http.StatusUnauthorized, reason: ReasonNoSession},
+		{name: "expired token without refresh", session: "token-expired", status: http.StatusUnauthorized, reason: ReasonNoSession},
+		{name: "missing scope", session: "narrow", status: http.StatusForbidden, reason: ReasonMissingScope, missing: OauthScopes{ScopeReadJql}},
+		{name: "rejected token", session: "revoked", status: http.StatusUnauthorized, reason: ReasonTokenInvalid},
+		{name: "atlassian down", session: "unverifiable", status: http.StatusBadGateway, reason: ReasonVerificationFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/transform", nil)
+			if tt.session != "" {
+				r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: tt.session})
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusOK {
+				if w.Body.String() != tt.body {
+					t.Errorf("body = %q, want %q", w.Body.String(), tt.body)
+				}
+				return
+			}
+
+			var got AuthError
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			want := AuthError{Error: http.StatusText(tt.status), Reason: tt.reason, Missing: tt.missing}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("body = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package shared
+
+import "testing"
+
+func TestCodeChallenge(t *testing.T) {
+	// RFC 7636 appendix B.
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	if got, want := CodeChallenge(verifier), "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("CodeChallenge(%q) = %q, want %q", verifier, got, want)
+	}
+}
+
+func TestNewCodeVerifier(t *testing.T) {
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifier) != 43 {
+		t.Errorf("verifier is %d characters, want 43", len(verifier))
+	}
+}
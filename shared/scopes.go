@@ -0,0 +1,184 @@
+package shared
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Scope is an Atlassian OAuth 2.0 (3LO) scope. Jira scopes are the granular
+// variants, see https://developer.atlassian.com/cloud/jira/platform/scopes-for-oauth-2-3LO-and-forge-apps/
+type Scope string
+
+const (
+	ScopeOfflineAccess          Scope = "offline_access"
+	ScopeReadMe                 Scope = "read:me"
+	ScopeReadProjectAvatar      Scope = "read:project.avatar:jira"
+	ScopeReadFilter             Scope = "read:filter:jira"
+	ScopeReadGroup              Scope = "read:group:jira"
+	ScopeReadIssue              Scope = "read:issue:jira"
+	ScopeReadAttachment         Scope = "read:attachment:jira"
+	ScopeReadComment            Scope = "read:comment:jira"
+	ScopeReadCommentProperty    Scope = "read:comment.property:jira"
+	ScopeReadField              Scope = "read:field:jira"
+	ScopeReadIssueDetails       Scope = "read:issue-details:jira"
+	ScopeReadFieldDefaultValue  Scope = "read:field.default-value:jira"
+	ScopeReadFieldOption        Scope = "read:field.option:jira"
+	ScopeReadIssueChangelog     Scope = "read:issue.changelog:jira"
+	ScopeReadIssueWorklog       Scope = "read:issue-worklog:jira"
+	ScopeReadIssueMeta          Scope = "read:issue-meta:jira"
+	ScopeReadJql                Scope = "read:jql:jira"
+	ScopeReadProject            Scope = "read:project:jira"
+	ScopeReadStatus             Scope = "read:status:jira"
+	ScopeReadUser               Scope = "read:user:jira"
+	ScopeReadAvatar             Scope = "read:avatar:jira"
+	ScopeReadIssueType          Scope = "read:issue-type:jira"
+	ScopeReadFieldConfiguration Scope = "read:field-configuration:jira"
+)
+
+var knownScopes = map[Scope]bool{
+	ScopeOfflineAccess:          true,
+	ScopeReadMe:                 true,
+	ScopeReadProjectAvatar:      true,
+	ScopeReadFilter:             true,
+	ScopeReadGroup:              true,
+	ScopeReadIssue:              true,
+	ScopeReadAttachment:         true,
+	ScopeReadComment:            true,
+	ScopeReadCommentProperty:    true,
+	ScopeReadField:              true,
+	ScopeReadIssueDetails:       true,
+	ScopeReadFieldDefaultValue:  true,
+	ScopeReadFieldOption:        true,
+	ScopeReadIssueChangelog:     true,
+	ScopeReadIssueWorklog:       true,
+	ScopeReadIssueMeta:          true,
+	ScopeReadJql:                true,
+	ScopeReadProject:            true,
+	ScopeReadStatus:             true,
+	ScopeReadUser:               true,
+	ScopeReadAvatar:             true,
+	ScopeReadIssueType:          true,
+	ScopeReadFieldConfiguration: true,
+}
+
+// OauthScopes is an ordered, de-duplicated set of scopes.
+type OauthScopes []Scope
+
+// DefaultScopes are requested when OAUTH_SCOPES isn't set. offline_access is
+// required for the refresh_token flow to be triggered.
+var DefaultScopes = NewScopes(
+	ScopeOfflineAccess,
+	ScopeReadMe,
+	ScopeReadProjectAvatar,
+	ScopeReadFilter,
+	ScopeReadGroup,
+	ScopeReadIssue,
+	ScopeReadAttachment,
+	ScopeReadComment,
+	ScopeReadCommentProperty,
+	ScopeReadField,
+	ScopeReadIssueDetails,
+	ScopeReadFieldDefaultValue,
+	ScopeReadFieldOption,
+	ScopeReadIssueChangelog,
+	ScopeReadStatus,
+	ScopeReadIssueWorklog,
+)
+
+func NewScopes(scopes ...Scope) OauthScopes {
+	seen := make(map[Scope]bool, len(scopes))
+	set := make(OauthScopes, 0, len(scopes))
+	for _, scope := range scopes {
+		if scope == "" || seen[scope] {
+			continue
+		}
+		seen[scope] = true
+		set = append(set, scope)
+	}
+	return set
+}
+
+// ParseScopes reads a space or comma separated scope list, such as the Scope
+// field of a token response or the OAUTH_SCOPES variable.
+func ParseScopes(raw string) OauthScopes {
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	scopes := make([]Scope, len(fields))
+	for i, field := range fields {
+		scopes[i] = Scope(field)
+	}
+	return NewScopes(scopes...)
+}
+
+// ScopesFromEnv falls back to DefaultScopes when nothing is configured.
+func ScopesFromEnv(raw string) OauthScopes {
+	if scopes := ParseScopes(raw); len(scopes) > 0 {
+		return scopes
+	}
+	return DefaultScopes
+}
+
+func (s OauthScopes) Validate() error {
+	var unknown []string
+	for _, scope := range s {
+		if !knownScopes[scope] {
+			unknown = append(unknown, string(scope))
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown oauth scopes: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+func (s OauthScopes) Contains(scope Scope) bool {
+	for _, have := range s {
+		if have == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (s OauthScopes) String() string {
+	parts := make([]string, len(s))
+	for i, scope := range s {
+		parts[i] = string(scope)
+	}
+	return strings.Join(parts, " ")
+}
+
+// MissingScopes lists the required scopes that the granted scope string lacks.
+func MissingScopes(granted string, required OauthScopes) OauthScopes {
+	have := ParseScopes(granted)
+
+	var missing OauthScopes
+	for _, scope := range required {
+		if !have.Contains(scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// RequireScopes rejects a request whose session was not granted everything
+// the endpoint needs, naming the missing scopes. It must run inside AuthGuard.
+func RequireScopes(log *log.Logger) func(required OauthScopes, h http.HandlerFunc) http.HandlerFunc {
+	return func(required OauthScopes, h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			session, _ := SessionFromContext(r.Context())
+			if session.ApiToken == nil {
+				if missing := MissingScopes(session.Token.Scope, required); len(missing) > 0 {
+					log.Printf("session missing scopes for %s: %s\n", r.URL.Path, missing)
+					denyAuth(w, log, http.StatusForbidden, ReasonMissingScope, missing)
+					return
+				}
+			}
+
+			h(w, r)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package shared
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want OauthScopes
+	}{
+		{raw: "", want: OauthScopes{}},
+		{raw: "read:me", want: OauthScopes{ScopeReadMe}},
+		{raw: "read:me read:jql:jira", want: OauthScopes{ScopeReadMe, ScopeReadJql}},
+		{raw: "read:me,read:jql:jira", want: OauthScopes{ScopeReadMe, ScopeReadJql}},
+		{raw: " read:me ,, read:jql:jira ", want: OauthScopes{ScopeReadMe, ScopeReadJql}},
+		{raw: "read:me read:jql:jira read:me", want: OauthScopes{ScopeReadMe, ScopeReadJql}},
+	}
+	for _, tt := range tests {
+		if got := ParseScopes(tt.raw); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseScopes(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestMissingScopes(t *testing.T) {
+	tests := []struct {
+		granted  string
+		required OauthScopes
+		want     OauthScopes
+	}{
+		{granted: "read:me read:jql:jira", required: NewScopes(ScopeReadMe, ScopeReadJql)},
+		{granted: "read:jql:jira read:me offline_access", required: NewScopes(ScopeReadMe)},
+		{granted: "read:me read:me", required: NewScopes(ScopeReadMe, ScopeReadMe)},
+		{granted: "read:me", required: NewScopes(ScopeReadMe, ScopeReadJql), want: OauthScopes{ScopeReadJql}},
+		{granted: "", required: NewScopes(ScopeReadMe, ScopeReadJql), want: OauthScopes{ScopeReadMe, ScopeReadJql}},
+		{granted: "read:me", required: NewScopes()},
+	}
+	for _, tt := range tests {
+		if got := MissingScopes(tt.granted, tt.required); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MissingScopes(%q, %v) = %v, want %v", tt.granted, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+	require := RequireScopes(log.New(io.Discard, "", 0))
+	handler := require(NewScopes(ScopeReadMe, ScopeReadIssueWorklog), func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name    string
+		session Session
+		status  int
+		missing OauthScopes
+	}{
+		{name: "granted", session: Session{Token: Oauth{Scope: "read:me read:issue-worklog:jira"}}, status: http.StatusNoContent},
+		{name: "granted with duplicates", session: Session{Token: Oauth{Scope: "read:me read:me,read:issue-worklog:jira"}}, status: http.StatusNoContent},
+		{name: "missing scope", session: Session{Token: Oauth{Scope: "read:me read:me"}}, status: http.StatusForbidden, missing: OauthScopes{ScopeReadIssueWorklog}},
+		{name: "api token", session: Session{ApiToken: &ApiToken{}}, status: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/worklogs", nil)
+			r = r.WithContext(WithSession(r.Context(), tt.session))
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusForbidden {
+				return
+			}
+			var got AuthError
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			want := AuthError{Error: "Forbidden", Reason: ReasonMissingScope, Missing: tt.missing}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("body = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
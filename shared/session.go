@@ -0,0 +1,295 @@
+package shared
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	sessionCookieName = "session_id"
+	sessionTTL        = 30 * 24 * time.Hour
+	refreshWindow     = 5 * time.Minute
+
+	SessionModeOauth    = "oauth"
+	SessionModeApiToken = "api_token"
+)
+
+var ErrNoSession = errors.New("no active session")
+
+type sessionKey struct{}
+
+// Session holds the Atlassian tokens server-side; the browser only ever sees
+// the opaque Id. Site caches CloudId's site as last resolved, so Jira calls
+// needn't ask Atlassian for the accessible sites every time.
+type Session struct {
+	Id        string      `json:"id"`
+	Token     Oauth       `json:"token"`
+	Expiry    time.Time   `json:"expiry"`
+	ApiToken  *ApiToken   `json:"apiToken,omitempty"`
+	CloudId   string      `json:"cloudId"`
+	Site      *Site       `json:"site,omitempty"`
+	Missing   OauthScopes `json:"missing,omitempty"`
+	CreatedAt time.Time   `json:"createdAt"`
+	ExpiresAt time.Time   `json:"expiresAt"`
+}
+
+// SessionInfo is the part of a session that is safe to hand to the page.
+type SessionInfo struct {
+	Mode          string      `json:"mode"`
+	Scope         string      `json:"scope"`
+	MissingScopes OauthScopes `json:"missingScopes,omitempty"`
+	Expiry        time.Time   `json:"expiry"`
+	CloudId       string      `json:"cloudId"`
+}
+
+func (s Session) Info() SessionInfo {
+	return SessionInfo{
+		Mode:          s.Mode(),
+		Scope:         s.Token.Scope,
+		MissingScopes: s.Missing,
+		Expiry:        s.Expiry,
+		CloudId:       s.CloudId,
+	}
+}
+
+// Mode reports which credential Jira calls use. An API token wins over OAuth
+// when both are present.
+func (s Session) Mode() string {
+	if s.ApiToken != nil {
+		return SessionModeApiToken
+	}
+	return SessionModeOauth
+}
+
+// Authorization is the header value for Jira calls made on behalf of this
+// session.
+func (s Session) Authorization() string {
+	if s.ApiToken != nil {
+		return s.ApiToken.Authorization()
+	}
+	return "Bearer " + s.Token.AccessToken
+}
+
+func WithSession(ctx context.Context, session Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+func SessionFromContext(ctx context.Context) (Session, bool) {
+	session, ok := ctx.Value(sessionKey{}).(Session)
+	return session, ok
+}
+
+type Sessions struct {
+	store  SessionStore
+	tokens TokenGranter
+	locks  sync.Map
+}
+
+func NewSessions(store SessionStore, tokens TokenGranter) *Sessions {
+	return &Sessions{store: store, tokens: tokens}
+}
+
+func newSessionId() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate session id: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func tokenExpiry(token Oauth, now time.Time) time.Time {
+	return now.Add(time.Duration(token.ExpiresIn) * time.Second)
+}
+
+// Start issues a fresh session for a completed login. Any session the browser
+// already carried is dropped so a login never reuses an existing id.
+func (s *Sessions) Start(ctx context.Context, w http.ResponseWriter, r *http.Request, token Oauth) (Session, error) {
+	now := time.Now().UTC()
+	return s.start(ctx, w, r, Session{
+		Token:  token,
+		Expiry: tokenExpiry(token, now),
+	})
+}
+
+// StartApiToken issues a session for callers who can't use OAuth at all.
+func (s *Sessions) StartApiToken(ctx context.Context, w http.ResponseWriter, r *http.Request, token ApiToken) (Session, error) {
+	return s.start(ctx, w, r, Session{ApiToken: &token})
+}
+
+func (s *Sessions) start(ctx context.Context, w http.ResponseWriter, r *http.Request, session Session) (Session, error) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		_ = s.store.Delete(ctx, cookie.Value)
+	}
+
+	id, err := newSessionId()
+	if err != nil {
+		return Session{}, err
+	}
+
+	now := time.Now().UTC()
+	session.Id = id
+	session.CreatedAt = now
+	session.ExpiresAt = now.Add(sessionTTL)
+	if err := s.store.Save(ctx, session); err != nil {
+		return Session{}, err
+	}
+
+	SetSessionCookie(w, session)
+	return session, nil
+}
+
+func (s *Sessions) End(ctx context.Context, w http.ResponseWriter, session Session) error {
+	s.locks.Delete(session.Id)
+	ClearSessionCookie(w)
+	return s.store.Delete(ctx, session.Id)
+}
+
+// Logout ends whatever session the browser carries and revokes its refresh
+// token. A missing or expired session is not an error: there is nothing left
+// to end.
+func (s *Sessions) Logout(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil
+	}
+
+	session, err := s.store.Get(ctx, cookie.Value)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.End(ctx, w, session); err != nil {
+		return err
+	}
+	if err := s.tokens.Revoke(ctx, session.Token.RefreshToken); err != nil {
+		return fmt.Errorf("session ended but refresh token was not revoked: %w", err)
+	}
+	return nil
+}
+
+// Load returns the caller's session, refreshing the access token first when
+// it is about to expire.
+func (s *Sessions) Load(ctx context.Context, r *http.Request) (Session, error) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return Session{}, ErrNoSession
+	}
+	return s.Get(ctx, cookie.Value)
+}
+
+// Get is Load for a session id held outside a request, such as by a
+// background job acting for the user after their request has ended.
+func (s *Sessions) Get(ctx context.Context, id string) (Session, error) {
+	session, err := s.store.Get(ctx, id)
+	if errors.Is(err, ErrSessionNotFound) {
+		return Session{}, ErrNoSession
+	}
+	if err != nil {
+		return Session{}, err
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		_ = s.store.Delete(ctx, session.Id)
+		return Session{}, ErrNoSession
+	}
+
+	if session.ApiToken == nil && time.Until(session.Expiry) < refreshWindow {
+		return s.refresh(ctx, session.Id, false)
+	}
+	return session, nil
+}
+
+func (s *Sessions) Save(ctx context.Context, session Session) error {
+	return s.store.Save(ctx, session)
+}
+
+func (s *Sessions) Refresh(ctx context.Context, session Session) (Session, error) {
+	return s.refresh(ctx, session.Id, true)
+}
+
+// Update applies change to the stored session rather than a copy carried by
+// the request, so it can't undo a token refresh that happened meanwhile.
+func (s *Sessions) Update(ctx context.Context, id string, change func(session *Session)) (Session, error) {
+	lock, _ := s.locks.LoadOrStore(id, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	session, err := s.store.Get(ctx, id)
+	if err != nil {
+		return Session{}, err
+	}
+	change(&session)
+	if err := s.store.Save(ctx, session); err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+// refresh serialises refreshes per session: Atlassian rotates refresh tokens,
+// so two concurrent grants with the same token would log the user out.
+func (s *Sessions) refresh(ctx context.Context, id string, force bool) (Session, error) {
+	lock, _ := s.locks.LoadOrStore(id, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	session, err := s.store.Get(ctx, id)
+	if err != nil {
+		return Session{}, err
+	}
+	if !force && time.Until(session.Expiry) >= refreshWindow {
+		return session, nil
+	}
+	if session.Token.RefreshToken == "" {
+		return Session{}, ErrNoSession
+	}
+
+	token, err := s.tokens.Refresh(ctx, session.Token.RefreshToken)
+	if err != nil {
+		return Session{}, err
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = session.Token.RefreshToken
+	}
+
+	now := time.Now().UTC()
+	session.Token = token
+	session.Expiry = tokenExpiry(token, now)
+	session.ExpiresAt = now.Add(sessionTTL)
+	if err := s.store.Save(ctx, session); err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+func SetSessionCookie(w http.ResponseWriter, session Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    session.Id,
+		Path:     "/",
+		MaxAge:   int(time.Until(session.ExpiresAt).Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func ClearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,146 @@
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionStore interface {
+	Get(ctx context.Context, id string) (Session, error)
+	Save(ctx context.Context, session Session) error
+	Delete(ctx context.Context, id string) error
+}
+
+type SessionConfig struct {
+	Store string
+	Path  string
+}
+
+func NewSessionStore(config SessionConfig) (SessionStore, error) {
+	switch config.Store {
+	case "", "memory":
+		return NewMemorySessionStore(), nil
+	case "file":
+		return NewFileSessionStore(config.Path)
+	default:
+		return nil, fmt.Errorf("unknown session store %q", config.Store)
+	}
+}
+
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]Session)}
+}
+
+func (s *MemorySessionStore) Get(_ context.Context, id string) (Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *MemorySessionStore) Save(_ context.Context, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.Id] = session
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+	return nil
+}
+
+// FileSessionStore keeps sessions in memory and rewrites a JSON file on every
+// change so logins survive a restart of the service.
+type FileSessionStore struct {
+	MemorySessionStore
+	path string
+}
+
+func NewFileSessionStore(path string) (*FileSessionStore, error) {
+	if path == "" {
+		return nil, errors.New("file session store requires a path")
+	}
+
+	store := &FileSessionStore{
+		MemorySessionStore: MemorySessionStore{sessions: make(map[string]Session)},
+		path:               path,
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read session file: %w", err)
+	}
+	if err := json.Unmarshal(raw, &store.sessions); err != nil {
+		return nil, fmt.Errorf("decode session file: %w", err)
+	}
+
+	now := time.Now()
+	for id, session := range store.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(store.sessions, id)
+		}
+	}
+	return store, nil
+}
+
+func (s *FileSessionStore) Save(_ context.Context, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.Id] = session
+	return s.flush()
+}
+
+func (s *FileSessionStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+	return s.flush()
+}
+
+// flush must be called with the lock held.
+func (s *FileSessionStore) flush() error {
+	raw, err := json.Marshal(s.sessions)
+	if err != nil {
+		return fmt.Errorf("encode sessions: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("create session directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("write session file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("replace session file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingGranter hands out a new access token per refresh and counts them.
+type countingGranter struct {
+	refreshes atomic.Int32
+	seen      sync.Map
+}
+
+func (g *countingGranter) ExchangeCode(context.Context, string, string) (Oauth, error) {
+	return Oauth{}, errors.New("not used")
+}
+
+func (g *countingGranter) Refresh(_ context.Context, refreshToken string) (Oauth, error) {
+	n := g.refreshes.Add(1)
+	if _, used := g.seen.LoadOrStore(refreshToken, true); used {
+		return Oauth{}, &OauthError{StatusCode: 403, Code: "invalid_grant"}
+	}
+	// Give concurrent callers time to pile up behind the lock.
+	time.Sleep(20 * time.Millisecond)
+	return Oauth{AccessToken: fmt.Sprintf("access-%d", n), RefreshToken: "rotated", ExpiresIn: 3600}, nil
+}
+
+func (g *countingGranter) Revoke(context.Context, string) error {
+	return nil
+}
+
+func TestSessionsGetRefreshesOnce(t *testing.T) {
+	store := NewMemorySessionStore()
+	granter := &countingGranter{}
+	sessions := NewSessions(store, granter)
+
+	now := time.Now().UTC()
+	expired := Session{
+		Id:        "id",
+		Token:     Oauth{AccessToken: "stale", RefreshToken: "original"},
+		Expiry:    now.Add(-time.Minute),
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	if err := store.Save(t.Context(), expired); err != nil {
+		t.Fatal(err)
+	}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([]Session, callers)
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = sessions.Get(t.Context(), "id")
+		}()
+	}
+	wg.Wait()
+
+	if n := granter.refreshes.Load(); n != 1 {
+		t.Errorf("refreshed %d times, want once", n)
+	}
+	for i := range callers {
+		if errs[i] != nil {
+			t.Fatalf("Get() = %v", errs[i])
+		}
+		if results[i].Token.AccessToken != "access-1" {
+			t.Errorf("caller %d got access token %q, want the refreshed one", i, results[i].Token.AccessToken)
+		}
+	}
+	if stored, _ := store.Get(t.Context(), "id"); stored.Token.RefreshToken != "rotated" {
+		t.Errorf("stored refresh token = %q, want the rotated one", stored.Token.RefreshToken)
+	}
+}
+
+func TestFileSessionStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions", "sessions.json")
+	store, err := NewFileSessionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2025, 2, 1, 9, 0, 0, 0, time.UTC)
+	session := Session{
+		Id:        "id",
+		Token:     Oauth{AccessToken: "access", RefreshToken: "refresh", Scope: "read:me", ExpiresIn: 3600},
+		Expiry:    now.Add(time.Hour),
+		CloudId:   "cloud",
+		Site:      &Site{Id: "cloud", Url: "https://example.atlassian.net"},
+		Missing:   OauthScopes{"write:jira-work"},
+		CreatedAt: now,
+		ExpiresAt: time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+	}
+	old := Session{Id: "old", ExpiresAt: time.Now().Add(-time.Hour).UTC()}
+	for _, s := range []Session{session, old} {
+		if err := store.Save(t.Context(), s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reloaded, err := NewFileSessionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reloaded.Get(t.Context(), "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, session) {
+		t.Errorf("reloaded session = %+v, want %+v", got, session)
+	}
+	if _, err := reloaded.Get(t.Context(), "old"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expired session survived the reload: %v", err)
+	}
+
+	if err := NewSessions(reloaded, nil).End(t.Context(), httptest.NewRecorder(), got); err != nil {
+		t.Fatal(err)
+	}
+	ended, err := NewFileSessionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ended.Get(t.Context(), "id"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("ended session survived the reload: %v", err)
+	}
+}
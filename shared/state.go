@@ -0,0 +1,170 @@
+package shared
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	stateCookieName = "oauth_state"
+	stateTTL        = 10 * time.Minute
+)
+
+var (
+	ErrStateSecret   = errors.New("oauth state secret is not configured")
+	ErrStateMissing  = errors.New("oauth state is missing")
+	ErrStateInvalid  = errors.New("oauth state signature is invalid")
+	ErrStateMismatch = errors.New("oauth state does not match this browser")
+	ErrStateExpired  = errors.New("oauth state has expired")
+	ErrStateReplayed = errors.New("oauth state has already been used")
+	ErrPkceMissing   = errors.New("oauth state is missing its PKCE verifier")
+)
+
+// AuthState is bound to the browser through a signed, HttpOnly cookie for the
+// duration of the login popup.
+type AuthState struct {
+	State    string `json:"state"`
+	Expires  int64  `json:"exp"`
+	Verifier string `json:"cv,omitempty"`
+}
+
+func NewAuthState(config JiraConfig) (AuthState, error) {
+	uniq, err := uuid.NewV7()
+	if err != nil {
+		return AuthState{}, fmt.Errorf("generate oauth state: %w", err)
+	}
+	state := AuthState{
+		State:   uniq.String(),
+		Expires: time.Now().Add(stateTTL).Unix(),
+	}
+
+	if config.Pkce {
+		if state.Verifier, err = NewCodeVerifier(); err != nil {
+			return AuthState{}, err
+		}
+	}
+	return state, nil
+}
+
+// ValidateStateSecret is checked at startup: without a secret no login can be
+// started or completed.
+func ValidateStateSecret(secret string) error {
+	if secret == "" {
+		return fmt.Errorf("%w: set STATE_SECRET", ErrStateSecret)
+	}
+	return nil
+}
+
+func signState(secret string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func SetStateCookie(w http.ResponseWriter, secret string, state AuthState) error {
+	if secret == "" {
+		return ErrStateSecret
+	}
+
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encode oauth state: %w", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName,
+		Value:    payload + "." + signState(secret, payload),
+		Path:     "/",
+		MaxAge:   int(stateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func ClearStateCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ReadStateCookie verifies the signature and expiry of the state cookie and
+// checks it against the state Atlassian echoed back to the callback.
+func ReadStateCookie(r *http.Request, secret string, returned string) (AuthState, error) {
+	var state AuthState
+	if secret == "" {
+		return state, ErrStateSecret
+	}
+
+	cookie, err := r.Cookie(stateCookieName)
+	if err != nil || returned == "" {
+		return state, ErrStateMissing
+	}
+
+	payload, signature, found := strings.Cut(cookie.Value, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(signState(secret, payload))) {
+		return state, ErrStateInvalid
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return state, ErrStateInvalid
+	}
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return state, ErrStateInvalid
+	}
+
+	if !hmac.Equal([]byte(state.State), []byte(returned)) {
+		return state, ErrStateMismatch
+	}
+	if time.Now().Unix() > state.Expires {
+		return state, ErrStateExpired
+	}
+	return state, nil
+}
+
+// StateLedger remembers consumed states until they expire so a captured
+// callback cannot be replayed while its cookie is still valid.
+type StateLedger struct {
+	mu   sync.Mutex
+	used map[string]int64
+}
+
+func NewStateLedger() *StateLedger {
+	return &StateLedger{used: make(map[string]int64)}
+}
+
+func (l *StateLedger) Consume(state AuthState) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now().Unix()
+	for key, expires := range l.used {
+		if now > expires {
+			delete(l.used, key)
+		}
+	}
+
+	if _, seen := l.used[state.State]; seen {
+		return ErrStateReplayed
+	}
+	l.used[state.State] = state.Expires
+	return nil
+}
@@ -0,0 +1,109 @@
+package shared
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stateCookie signs state with secret and returns the cookie the browser
+// would send back.
+func stateCookie(t *testing.T, secret string, state AuthState) *http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := SetStateCookie(w, secret, state); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+	return cookies[0]
+}
+
+func TestReadStateCookie(t *testing.T) {
+	const secret = "secret"
+	valid := AuthState{State: "abc", Expires: time.Now().Add(time.Minute).Unix(), Verifier: "verifier"}
+	expired := AuthState{State: "abc", Expires: time.Now().Add(-time.Minute).Unix()}
+
+	tampered := stateCookie(t, secret, valid)
+	payload, signature, _ := strings.Cut(tampered.Value, ".")
+	flipped := "A"
+	if signature[0] == 'A' {
+		flipped = "B"
+	}
+	tampered.Value = payload + "." + flipped + signature[1:]
+	forged := stateCookie(t, "other secret", valid)
+
+	tests := []struct {
+		name     string
+		cookie   *http.Cookie
+		secret   string
+		returned string
+		want     error
+	}{
+		{name: "valid", cookie: stateCookie(t, secret, valid), secret: secret, returned: "abc"},
+		{name: "no secret", cookie: stateCookie(t, secret, valid), returned: "abc", want: ErrStateSecret},
+		{name: "no cookie", secret: secret, returned: "abc", want: ErrStateMissing},
+		{name: "no returned state", cookie: stateCookie(t, secret, valid), secret: secret, want: ErrStateMissing},
+		{name: "tampered signature", cookie: tampered, secret: secret, returned: "abc", want: ErrStateInvalid},
+		{name: "signed with another secret", cookie: forged, secret: secret, returned: "abc", want: ErrStateInvalid},
+		{name: "unsigned", cookie: &http.Cookie{Name: stateCookieName, Value: payload}, secret: secret, returned: "abc", want: ErrStateInvalid},
+		{name: "state mismatch", cookie: stateCookie(t, secret, valid), secret: secret, returned: "abd", want: ErrStateMismatch},
+		{name: "expired", cookie: stateCookie(t, secret, expired), secret: secret, returned: "abc", want: ErrStateExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/callback", nil)
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+			state, err := ReadStateCookie(r, tt.secret, tt.returned)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ReadStateCookie() = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && state != valid {
+				t.Errorf("state = %+v, want %+v", state, valid)
+			}
+		})
+	}
+}
+
+func TestStateLedger(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		states []AuthState
+		want   []error
+	}{
+		{
+			name:   "different states",
+			states: []AuthState{{State: "a", Expires: now.Add(time.Minute).Unix()}, {State: "b", Expires: now.Add(time.Minute).Unix()}},
+			want:   []error{nil, nil},
+		},
+		{
+			name:   "replayed state",
+			states: []AuthState{{State: "a", Expires: now.Add(time.Minute).Unix()}, {State: "a", Expires: now.Add(time.Minute).Unix()}},
+			want:   []error{nil, ErrStateReplayed},
+		},
+		{
+			// Expired states are forgotten; ReadStateCookie rejects them first.
+			name:   "expired state forgotten",
+			states: []AuthState{{State: "a", Expires: now.Add(-time.Minute).Unix()}, {State: "a", Expires: now.Add(time.Minute).Unix()}},
+			want:   []error{nil, nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := NewStateLedger()
+			for i, state := range tt.states {
+				if err := ledger.Consume(state); !errors.Is(err, tt.want[i]) {
+					t.Errorf("Consume(%s) #%d = %v, want %v", state.State, i+1, err, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package shared
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const tokenRequestTimeout = 15 * time.Second
+
+var ErrEmptyToken = errors.New("token endpoint returned an empty access token")
+
+type TokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	ClientId     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	Code         string `json:"code,omitempty"`
+	RedirectUri  string `json:"redirect_uri,omitempty"`
+	CodeVerifier string `json:"code_verifier,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// OauthError is the error body Atlassian returns from the token endpoint.
+type OauthError struct {
+	StatusCode  int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *OauthError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("token endpoint responded with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("token endpoint responded with status %d: %s %s", e.StatusCode, e.Code, e.Description)
+}
+
+type TokenGranter interface {
+	ExchangeCode(ctx context.Context, code string, verifier string) (Oauth, error)
+	Refresh(ctx context.Context, refreshToken string) (Oauth, error)
+	Revoke(ctx context.Context, refreshToken string) error
+}
+
+type TokenClient struct {
+	http   *http.Client
+	config JiraConfig
+}
+
+func NewTokenClient(config JiraConfig) *TokenClient {
+	return &TokenClient{
+		http:   &http.Client{Timeout: tokenRequestTimeout},
+		config: config,
+	}
+}
+
+func (c *TokenClient) ExchangeCode(ctx context.Context, code string, verifier string) (Oauth, error) {
+	return c.grant(ctx, TokenRequest{
+		GrantType:    "authorization_code",
+		ClientId:     c.config.Cid,
+		ClientSecret: c.config.Secret,
+		Code:         code,
+		RedirectUri:  c.config.RedirectUrl,
+		CodeVerifier: verifier,
+	})
+}
+
+func (c *TokenClient) Refresh(ctx context.Context, refreshToken string) (Oauth, error) {
+	return c.grant(ctx, TokenRequest{
+		GrantType:    "refresh_token",
+		ClientId:     c.config.Cid,
+		ClientSecret: c.config.Secret,
+		RefreshToken: refreshToken,
+	})
+}
+
+func (c *TokenClient) grant(ctx context.Context, body TokenRequest) (Oauth, error) {
+	var token Oauth
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return token, fmt.Errorf("encode %s grant: %w", body.GrantType, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tokenRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.OauthUrl, bytes.NewReader(payload))
+	if err != nil {
+		return token, fmt.Errorf("build %s grant: %w", body.GrantType, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return token, fmt.Errorf("%s grant: %w", body.GrantType, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		oauthErr := &OauthError{StatusCode: res.StatusCode}
+		raw, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+		_ = json.Unmarshal(raw, oauthErr)
+		return token, oauthErr
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return token, fmt.Errorf("decode %s grant: %w", body.GrantType, err)
+	}
+	if token.AccessToken == "" {
+		return token, ErrEmptyToken
+	}
+	return token, nil
+}
+
+// Revoke asks the authorisation server to invalidate a refresh token (RFC
+// 7009). Atlassian doesn't publish a revocation endpoint for 3LO apps, so this
+// is a no-op unless REVOKE_URL is configured.
+func (c *TokenClient) Revoke(ctx context.Context, refreshToken string) error {
+	if c.config.RevokeUrl == "" || refreshToken == "" {
+		return nil
+	}
+
+	form := url.Values{}
+	form.Set("token", refreshToken)
+	form.Set("token_type_hint", "refresh_token")
+	form.Set("client_id", c.config.Cid)
+	form.Set("client_secret", c.config.Secret)
+
+	ctx, cancel := context.WithTimeout(ctx, tokenRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.RevokeUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("build revoke request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("revoke request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		oauthErr := &OauthError{StatusCode: res.StatusCode}
+		raw, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+		_ = json.Unmarshal(raw, oauthErr)
+		return oauthErr
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package shared
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenClientGrant(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		want      Oauth
+		wantOauth *OauthError
+		wantErr   error
+	}{
+		{
+			name:   "token",
+			status: http.StatusOK,
+			body:   `{"access_token":"access","token_type":"Bearer","scope":"read:me","expires_in":3600,"refresh_token":"refresh"}`,
+			want:   Oauth{AccessToken: "access", TokenType: "Bearer", Scope: "read:me", ExpiresIn: 3600, RefreshToken: "refresh"},
+		},
+		{
+			name:      "oauth error",
+			status:    http.StatusForbidden,
+			body:      `{"error":"invalid_grant","error_description":"Unknown or invalid refresh token."}`,
+			wantOauth: &OauthError{StatusCode: http.StatusForbidden, Code: "invalid_grant", Description: "Unknown or invalid refresh token."},
+		},
+		{
+			name:      "error without a body",
+			status:    http.StatusInternalServerError,
+			wantOauth: &OauthError{StatusCode: http.StatusInternalServerError},
+		},
+		{name: "empty body", status: http.StatusOK},
+		{name: "invalid json", status: http.StatusOK, body: `<html>`},
+		{name: "no access token", status: http.StatusOK, body: `{"token_type":"Bearer"}`, wantErr: ErrEmptyToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got TokenRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("decode grant: %v", err)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewTokenClient(JiraConfig{OauthUrl: server.URL, Cid: "cid", Secret: "secret"})
+			token, err := client.Refresh(t.Context(), "refresh")
+			if got.GrantType != "refresh_token" || got.RefreshToken != "refresh" || got.ClientId != "cid" {
+				t.Errorf("grant = %+v", got)
+			}
+
+			switch {
+			case tt.wantOauth != nil:
+				var oauthErr *OauthError
+				if !errors.As(err, &oauthErr) {
+					t.Fatalf("Refresh() = %v, want an OauthError", err)
+				}
+				if *oauthErr != *tt.wantOauth {
+					t.Errorf("error = %+v, want %+v", *oauthErr, *tt.wantOauth)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Refresh() = %v, want %v", err, tt.wantErr)
+				}
+			case tt.want.AccessToken == "":
+				if err == nil {
+					t.Error("Refresh() succeeded, want a decode error")
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if token != tt.want {
+					t.Errorf("token = %+v, want %+v", token, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenClientUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	client := NewTokenClient(JiraConfig{OauthUrl: server.URL})
+	if _, err := client.ExchangeCode(t.Context(), "code", "verifier"); err == nil {
+		t.Error("ExchangeCode() succeeded against a closed server")
+	}
+	if _, err := client.Refresh(t.Context(), "refresh"); err == nil {
+		t.Error("Refresh() succeeded against a closed server")
+	}
+}
@@ -0,0 +1,109 @@
+package shared
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	verifyTTL     = time.Minute
+	verifyTimeout = 10 * time.Second
+)
+
+// Reasons returned to the page alongside a 401, or a 403 for missing scopes,
+// so it can decide whether to log in again or just ask for more scopes.
+const (
+	ReasonNoSession          = "no_session"
+	ReasonTokenInvalid       = "token_invalid"
+	ReasonMissingScope       = "missing_scope"
+	ReasonVerificationFailed = "verification_failed"
+)
+
+type AuthError struct {
+	Error   string      `json:"error"`
+	Reason  string      `json:"reason"`
+	Missing OauthScopes `json:"missing,omitempty"`
+}
+
+type userKey struct{}
+
+func WithUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+func UserFromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(userKey{}).(User)
+	return user, ok
+}
+
+type verifiedToken struct {
+	user    User
+	expires time.Time
+}
+
+// TokenVerifier resolves a session's credential to its Atlassian user,
+// caching the answer briefly so every guarded request doesn't cost a round
+// trip.
+type TokenVerifier struct {
+	http  *http.Client
+	mu    sync.Mutex
+	cache map[string]verifiedToken
+}
+
+func NewTokenVerifier() *TokenVerifier {
+	return &TokenVerifier{
+		http:  &http.Client{Timeout: verifyTimeout},
+		cache: make(map[string]verifiedToken),
+	}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify resolves whichever credential the session carries to its user.
+func (v *TokenVerifier) Verify(ctx context.Context, session Session) (User, error) {
+	key := hashToken(session.Authorization())
+	now := time.Now()
+
+	v.mu.Lock()
+	if entry, ok := v.cache[key]; ok && now.Before(entry.expires) {
+		v.mu.Unlock()
+		return entry.user, nil
+	}
+	v.mu.Unlock()
+
+	var user User
+	var err error
+	if session.ApiToken != nil {
+		user, err = GetJiraMyself(ctx, v.http, *session.ApiToken)
+	} else {
+		user, err = GetCurrentUser(ctx, v.http, session.Token.AccessToken)
+	}
+	if err != nil {
+		return user, err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for k, entry := range v.cache {
+		if now.After(entry.expires) {
+			delete(v.cache, k)
+		}
+	}
+	v.cache[key] = verifiedToken{user: user, expires: now.Add(verifyTTL)}
+	return user, nil
+}
+
+func WriteAuthError(w http.ResponseWriter, status int, reason string, missing OauthScopes) error {
+	return Encode(w, status, AuthError{
+		Error:   http.StatusText(status),
+		Reason:  reason,
+		Missing: missing,
+	})
+}